@@ -0,0 +1,167 @@
+package httpext
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+
+	"github.com/kenkeiter/httpext/httperror"
+	"github.com/kenkeiter/httpext/middleware"
+)
+
+// ErrEncodingNotAcceptable is written by Compress in response to requests
+// whose Accept-Encoding header excludes every supported content coding,
+// identity included.
+var ErrEncodingNotAcceptable = httperror.New(http.StatusNotAcceptable, "encoding_not_acceptable",
+	"None of the acceptable content codings are supported.")
+
+// Encoder returns an io.WriteCloser which compresses everything written to it
+// into w. Closing it must flush any buffered data, but not close w.
+type Encoder func(w io.Writer) io.WriteCloser
+
+// encoders maps content codings to the Encoders that produce them. Encoders
+// relying on third-party packages register themselves from files behind build
+// tags (see compress_brotli.go).
+var encoders = map[string]Encoder{
+	"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+}
+
+// encodingPreference orders content codings from most to least preferred, and
+// is used to break ties between codings the client weighs equally.
+var encodingPreference = []string{"br", "gzip"}
+
+// NegotiateEncoding returns the supported content coding best matching the
+// request's Accept-Encoding header, preferring br over gzip over identity when
+// the client weighs them equally. If the client accepts no supported coding,
+// not even identity, then "" is returned.
+func NegotiateEncoding(r *http.Request) string {
+	specs := ParseAccept(r.Header, "Accept-Encoding")
+	best, bestQ := "", 0.0
+	for _, coding := range encodingPreference {
+		if _, ok := encoders[coding]; !ok {
+			continue
+		}
+		if q, ok := acceptQuality(specs, coding); ok && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	if best != "" {
+		return best
+	}
+	// identity is acceptable unless explicitly excluded (RFC 7231, 5.3.4)
+	if q, ok := acceptQuality(specs, "identity"); ok && q == 0 {
+		return ""
+	}
+	return "identity"
+}
+
+// acceptQuality returns the weight given to value by specs, preferring an
+// exact match over a wildcard, and whether value was matched at all.
+func acceptQuality(specs []AcceptSpec, value string) (q float64, ok bool) {
+	for _, spec := range specs {
+		switch spec.Value {
+		case value:
+			return spec.Q, true
+		case "*":
+			q, ok = spec.Q, true
+		}
+	}
+	return q, ok
+}
+
+// Compress returns middleware which compresses response bodies using the
+// content coding negotiated by NegotiateEncoding. Responses that already have
+// a Content-Encoding, partial responses (which describe ranges of the
+// uncompressed body), and responses without a body are left untouched. Should
+// the client accept no supported coding, not even identity, the request is
+// answered with ErrEncodingNotAcceptable.
+func Compress() middleware.Handler {
+	responder := &httperror.Responder{}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			coding := NegotiateEncoding(req)
+			if coding == "" {
+				responder.Write(w, ErrEncodingNotAcceptable)
+				return
+			}
+			encoder, ok := encoders[coding]
+			if !ok || req.Method == "HEAD" {
+				next.ServeHTTP(w, req)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, coding: coding, encoder: encoder}
+			defer cw.Close()
+			next.ServeHTTP(cw, req)
+		})
+	}
+}
+
+// compressWriter compresses the body written through it, deciding whether to
+// do so when the header is written.
+type compressWriter struct {
+	http.ResponseWriter
+
+	coding      string
+	encoder     Encoder
+	w           io.WriteCloser
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader || status < http.StatusOK {
+		// informational responses precede the final one
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	hasBody := status != http.StatusNoContent && status != http.StatusNotModified
+	// the ranges of a partial response are those of the uncompressed body
+	partial := status == http.StatusPartialContent || h.Get(HeaderNameContentRange) != ""
+	if hasBody && !partial && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", cw.coding)
+		h.Del("Content-Length")
+		cw.w = cw.encoder(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.w == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.w.Write(b)
+}
+
+// Flush flushes data buffered by the encoder, and then the underlying
+// http.ResponseWriter.
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := cw.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close flushes the remainder of the compressed body.
+func (cw *compressWriter) Close() error {
+	if cw.w == nil {
+		return nil
+	}
+	return cw.w.Close()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,14 @@
+//go:build brotli
+// +build brotli
+
+package httpext
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+func init() {
+	encoders["br"] = func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }
+}
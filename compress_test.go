@@ -0,0 +1,177 @@
+package httpext
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kenkeiter/httpext/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// nopEncoder stands in for encoders which may not be compiled in.
+func nopEncoder(w io.Writer) io.WriteCloser {
+	return nopWriteCloser{w}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+var negotiateEncodingTests = []struct {
+	s      string
+	expect string
+}{
+	{"", "identity"},
+	{"gzip", "gzip"},
+	{"br", "br"},
+	{"gzip, br", "br"},
+	{"br, gzip", "br"},
+	{"*", "br"},
+	{"br;q=0.5, gzip", "gzip"},
+	{"br;q=0.5, gzip;q=0.8", "gzip"},
+	{"br;q=0.8, gzip;q=0.8", "br"},
+	{"br;q=0, *", "gzip"},
+	{"br;q=0, gzip;q=0", "identity"},
+	{"deflate", "identity"},
+	{"gzip;q=0, identity;q=0.5", "identity"},
+	{"*;q=0", ""},
+	{"br;q=0, gzip;q=0, identity;q=0", ""},
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	prev, ok := encoders["br"]
+	encoders["br"] = nopEncoder
+	defer func() {
+		if ok {
+			encoders["br"] = prev
+		} else {
+			delete(encoders, "br")
+		}
+	}()
+
+	for _, tt := range negotiateEncodingTests {
+		r := &http.Request{Header: http.Header{"Accept-Encoding": {tt.s}}}
+		actual := NegotiateEncoding(r)
+		assert.Equal(t, tt.expect, actual, "NegotiateEncoding(%q)", tt.s)
+	}
+}
+
+func compressTest(acceptEncoding string, h http.HandlerFunc) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/example", nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	w := httptest.NewRecorder()
+	Compress()(h).ServeHTTP(w, req)
+	return w
+}
+
+func TestCompressGzip(t *testing.T) {
+	resp := compressTest("gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "13")
+		w.Write([]byte("Hello, world!"))
+	})
+
+	assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"),
+		"Response should be gzip-encoded.")
+	assert.Equal(t, "Accept-Encoding", resp.Header().Get("Vary"),
+		"Response should vary on Accept-Encoding.")
+	assert.Empty(t, resp.Header().Get("Content-Length"),
+		"Content-Length of the uncompressed body should be removed.")
+	zr, err := gzip.NewReader(resp.Body)
+	assert.NoError(t, err, "Body should be valid gzip.")
+	body, err := io.ReadAll(zr)
+	assert.NoError(t, err, "Body should be valid gzip.")
+	assert.Equal(t, "Hello, world!", string(body), "Body should decompress to the original.")
+}
+
+func TestCompressIdentity(t *testing.T) {
+	resp := compressTest("", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, world!"))
+	})
+
+	assert.Empty(t, resp.Header().Get("Content-Encoding"),
+		"Response should not be encoded.")
+	assert.Equal(t, "Hello, world!", resp.Body.String(), "Body should be passed through.")
+}
+
+func TestCompressAlreadyEncoded(t *testing.T) {
+	resp := compressTest("gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "x-custom")
+		w.Write([]byte("Hello, world!"))
+	})
+
+	assert.Equal(t, "x-custom", resp.Header().Get("Content-Encoding"),
+		"Existing Content-Encoding should be preserved.")
+	assert.Equal(t, "Hello, world!", resp.Body.String(), "Body should be passed through.")
+}
+
+func TestCompressNotAcceptable(t *testing.T) {
+	called := false
+	resp := compressTest("gzip;q=0, identity;q=0", func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	assert.False(t, called, "The handler should not be called.")
+	assert.Equal(t, http.StatusNotAcceptable, resp.Code,
+		"Requests excluding every coding should be answered with 406.")
+	assert.Empty(t, resp.Header().Get("Content-Encoding"))
+}
+
+func TestCompressPartialContent(t *testing.T) {
+	resp := compressTest("gzip", func(w http.ResponseWriter, r *http.Request) {
+		ServePartial(w, httptest.NewRequest("GET", "/", nil), "bytes", 13, strings.NewReader("Hello, world!"))
+	})
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"), "Full responses should be compressed.")
+
+	resp = compressTest("gzip", func(w http.ResponseWriter, r *http.Request) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Range", "bytes=7-11")
+		ServePartial(w, req, "bytes", 13, strings.NewReader("Hello, world!"))
+	})
+	assert.Equal(t, http.StatusPartialContent, resp.Code)
+	assert.Empty(t, resp.Header().Get("Content-Encoding"), "Partial responses should not be compressed.")
+	assert.Equal(t, "bytes 7-11/13", resp.Header().Get(HeaderNameContentRange))
+	assert.Equal(t, "5", resp.Header().Get("Content-Length"), "Content-Length should be preserved.")
+	assert.Equal(t, "world", resp.Body.String(), "Body should be passed through.")
+}
+
+func TestCompressTrailers(t *testing.T) {
+	ms := &middleware.Set{}
+	ms.Use(Compress())
+	ms.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(middleware.NewResponseWriter(w), r)
+		})
+	})
+	srv := httptest.NewServer(ms.Apply(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("Hello, world!"))
+		w.(http.Flusher).Flush()
+		w.Header().Set("X-Checksum", "abc123")
+		w.Header().Set(http.TrailerPrefix+"X-Undeclared", "def456")
+	})))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"), "Response should be gzip-encoded.")
+	zr, err := gzip.NewReader(resp.Body)
+	assert.NoError(t, err, "Body should be valid gzip.")
+	body, err := io.ReadAll(zr)
+	assert.NoError(t, err, "Body should be valid gzip.")
+	io.Copy(io.Discard, resp.Body)
+	assert.Equal(t, "Hello, world!", string(body), "Body should decompress to the original.")
+	assert.Equal(t, "abc123", resp.Trailer.Get("X-Checksum"),
+		"Declared trailers should survive compression.")
+	assert.Equal(t, "def456", resp.Trailer.Get("X-Undeclared"),
+		"TrailerPrefix trailers should survive compression.")
+}
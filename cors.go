@@ -6,6 +6,10 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/kenkeiter/httpext/httperror"
+	"github.com/kenkeiter/httpext/middleware"
+	"golang.org/x/net/publicsuffix"
 )
 
 const (
@@ -20,11 +24,51 @@ const (
 
 var (
 	ErrUnmatchedCORSOrigin = errors.New("Unmatched CORS origin.")
+
+	// ErrCORSInvalidHeaderName is reported by Validate for a configured header
+	// name which isn't a valid HTTP token.
+	ErrCORSInvalidHeaderName = errors.New("CORS header name is not a valid token")
+
+	// ErrCORSInvalidOrigin indicates that an origin cannot be used in the
+	// policy being configured.
+	ErrCORSInvalidOrigin = errors.New("invalid CORS origin")
+
+	// ErrCORSWildcardCredentials is reported by Validate for a policy which
+	// allows credentials from any origin. Though the origin is reflected in
+	// place of the wildcard, doing so allows any site to make credentialed
+	// requests on behalf of its visitors.
+	ErrCORSWildcardCredentials = errors.New("CORS credentials allowed for all origins")
+
+	// ErrCORSNoOrigins is reported by Validate for a policy which sets
+	// StrictReject, but allows no origins, so that it rejects every
+	// cross-origin request.
+	ErrCORSNoOrigins = errors.New("CORS policy rejects all origins")
+
+	// ErrCORSOriginDenied is written by a policy's Middleware in response to
+	// requests from disallowed origins when StrictReject is set.
+	ErrCORSOriginDenied = httperror.New(http.StatusForbidden, "cors_origin_denied",
+		"Requests from this origin are not allowed.")
+
+	// ErrCORSOriginCheckFailed is written by a policy's Middleware when the
+	// function set with AllowOriginFuncErr fails to determine whether an
+	// origin is allowed.
+	ErrCORSOriginCheckFailed = httperror.New(http.StatusInternalServerError,
+		"cors_origin_check_failed", "The origin of the request could not be verified.")
 )
 
 type CORSPolicy struct {
 	allowAllOrigins bool
 	origins         []string
+	originSet       map[string]struct{}
+	originPatterns  []originPattern
+
+	allowSameOrigin bool
+	serverOrigin    string
+
+	fixedOrigin string
+
+	allowOriginFunc func(origin string) bool
+	originFunc      func(origin string, req *http.Request) (bool, error)
 
 	allowAllMethods bool
 	methods         []string
@@ -32,20 +76,259 @@ type CORSPolicy struct {
 	allowAllHeaders bool
 	allowHeaders    []string
 
-	exposeHeaders []string
+	exposeAllHeaders bool
+	exposeHeaders    []string
+
+	MaxAge time.Duration
 
-	MaxAge           time.Duration
+	// AllowCredentials allows requests to include credentials. Since browsers
+	// reject a wildcard Access-Control-Allow-Origin in responses allowing
+	// credentials, the request's Origin is reflected in its place (along with
+	// Vary: Origin), as are the requested method and headers in place of any
+	// other wildcards; a literal "*" is never sent. Credentials may instead be
+	// allowed for particular methods alone with AllowCredentialsForMethods.
 	AllowCredentials bool
+	credsMethods     []string
+
+	// ReflectRequestHeaders causes preflight responses to allow exactly the
+	// headers requested, copying Access-Control-Request-Headers verbatim into
+	// Access-Control-Allow-Headers -- along with Vary:
+	// Access-Control-Request-Headers -- in place of the headers allowed by
+	// AllowHeaders or AllowAllHeaders. Unlike the wildcard, reflected headers
+	// are honored by browsers for credentialed requests.
+	ReflectRequestHeaders bool
+
+	// AlwaysSendHeaders forces WriteHeaders to emit CORS headers even when the
+	// request carries no Origin header. By default such requests -- typically
+	// from non-browser clients -- receive no CORS headers at all.
+	AlwaysSendHeaders bool
+
+	// DeferCredentials causes WriteHeaders to leave any
+	// Access-Control-Allow-Credentials header already set on the response --
+	// by an upstream proxy or middleware, for example -- as it is.
+	DeferCredentials bool
+
+	// PreflightContinue, if set, is called by the policy's Middleware for each
+	// preflight request, after CORS headers have been written but before the
+	// preflight is answered. If it returns false, the preflight is not
+	// answered; PreflightContinue is expected to have written a response.
+	PreflightContinue func(w http.ResponseWriter, req *http.Request) bool
+
+	// PostWrite, if set, is called by WriteHeaders once it has written the
+	// policy's headers, allowing them to be modified, or others added, for
+	// each request. It isn't called for requests to which WriteHeaders writes
+	// no headers.
+	PostWrite func(w http.ResponseWriter, req *http.Request)
+
+	// StrictReject causes the policy's Middleware to respond to requests from
+	// disallowed origins with ErrCORSOriginDenied, rather than passing them
+	// through with an Access-Control-Allow-Origin of "null".
+	StrictReject bool
+
+	// Responder writes errors on behalf of the policy's Middleware, in the
+	// media type negotiated with the client (see WriteError). If nil, a
+	// zero-value httperror.Responder is used.
+	Responder *httperror.Responder
 }
 
 func (c *CORSPolicy) AllowOrigins(o ...string) {
 	c.allowAllOrigins = false
+	c.fixedOrigin = ""
 	c.origins = append(c.origins, o...)
+	if c.originSet == nil {
+		c.originSet = make(map[string]struct{}, len(o))
+	}
+	for _, origin := range o {
+		c.originSet[origin] = struct{}{}
+	}
 }
 
 func (c *CORSPolicy) AllowAllOrigins() {
 	c.allowAllOrigins = true
+	c.fixedOrigin = ""
 	c.origins = []string{}
+	c.originSet = nil
+	c.originPatterns = nil
+}
+
+// AllowFixedOrigin allows requests only from origin, and causes WriteHeaders
+// to emit origin itself as the Access-Control-Allow-Origin of every response,
+// rather than reflecting each request's Origin, and to omit Vary: Origin.
+// Responses then no longer depend on the request's Origin, so that caches and
+// CDNs which cannot vary on it may store a single copy.
+//
+// The tradeoff is that a disallowed origin receives the configured origin
+// rather than "null", leaving the browser to reject the mismatch, and that
+// only one origin can be allowed. Calling AllowOrigins or AllowAllOrigins
+// afterwards returns the policy to reflecting origins.
+func (c *CORSPolicy) AllowFixedOrigin(origin string) {
+	c.allowAllOrigins = false
+	c.fixedOrigin = origin
+	c.origins = []string{origin}
+	c.originPatterns = nil
+	c.indexOrigins()
+}
+
+// AllowOriginPatterns allows requests from any origin matching one of the
+// patterns, each of which has a wildcard in place of the leftmost label of its
+// host: "https://*.example.com" matches "https://app.example.com" and
+// "https://api.example.com", but neither "https://example.com", nor
+// "https://a.b.example.com", nor "https://example.com.evil.net". The scheme and
+// port of an origin must match those of the pattern exactly, and its host
+// case-insensitively. The wildcard must be followed by a registrable domain,
+// not a public suffix, so that patterns such as "https://*.com",
+// "https://*.co.uk", and "https://*.github.io" are rejected as too broad. If any
+// pattern is invalid, AllowOriginPatterns returns an error wrapping
+// ErrCORSInvalidOrigin, and the policy is unmodified.
+func (c *CORSPolicy) AllowOriginPatterns(patterns ...string) error {
+	parsed := make([]originPattern, 0, len(patterns))
+	for _, p := range patterns {
+		op, err := parseOriginPattern(p)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, op)
+	}
+	c.allowAllOrigins = false
+	c.fixedOrigin = ""
+	c.originPatterns = append(c.originPatterns, parsed...)
+	return nil
+}
+
+// originPattern matches origins whose host is a single label followed by
+// suffix, such as "app" followed by ".example.com".
+type originPattern struct {
+	scheme string
+	suffix string
+	port   string
+}
+
+func parseOriginPattern(p string) (originPattern, error) {
+	scheme, host, port, ok := splitOrigin(p)
+	if !ok || !strings.HasPrefix(host, "*.") {
+		return originPattern{}, fmt.Errorf("%w: %q must have a wildcard as its leftmost host label", ErrCORSInvalidOrigin, p)
+	}
+	suffix := host[1:]
+	if strings.Contains(suffix, "*") || strings.Contains(suffix, "..") || strings.HasSuffix(suffix, ".") {
+		return originPattern{}, fmt.Errorf("%w: %q must have a wildcard as its leftmost host label", ErrCORSInvalidOrigin, p)
+	}
+	// a wildcard directly beneath a public suffix, such as "co.uk" or
+	// "github.io", would match sites under the control of anyone
+	if _, err := publicsuffix.EffectiveTLDPlusOne(suffix[1:]); err != nil {
+		return originPattern{}, fmt.Errorf("%w: %q matches too broadly", ErrCORSInvalidOrigin, p)
+	}
+	return originPattern{scheme: scheme, suffix: suffix, port: port}, nil
+}
+
+func (p originPattern) match(origin string) bool {
+	scheme, host, port, ok := splitOrigin(origin)
+	if !ok || scheme != p.scheme || port != p.port {
+		return false
+	}
+	label := strings.TrimSuffix(host, p.suffix)
+	return len(label) < len(host) && label != "" && !strings.ContainsAny(label, ".*")
+}
+
+// splitOrigin splits an origin, such as "https://example.com:8443", into its
+// lowercased scheme and host, and its port, if any. It reports false for
+// anything but a bare origin, such as one with a path or user information.
+func splitOrigin(origin string) (scheme, host, port string, ok bool) {
+	i := strings.Index(origin, "://")
+	if i <= 0 {
+		return "", "", "", false
+	}
+	scheme, host = strings.ToLower(origin[:i]), strings.ToLower(origin[i+3:])
+	if strings.ContainsAny(host, "/?#@\\") {
+		return "", "", "", false
+	}
+	if j := strings.LastIndexByte(host, ':'); j >= 0 {
+		host, port = host[:j], host[j+1:]
+		if port == "" {
+			return "", "", "", false
+		}
+	}
+	return scheme, host, port, host != ""
+}
+
+// AllowSameOrigin allows requests whose Origin is the server's own, such as
+// those made by a frontend served alongside an API. If serverOrigin is given,
+// in the form "https://example.com", it is used as the server's origin;
+// otherwise the origin is derived from each request's Host, with a scheme of
+// https if the request was received over TLS. Origins are compared
+// case-insensitively.
+func (c *CORSPolicy) AllowSameOrigin(serverOrigin string) {
+	c.allowSameOrigin = true
+	c.serverOrigin = serverOrigin
+}
+
+// AllowOriginFunc allows requests from any origin for which f returns true, in
+// addition to those allowed otherwise, for origins which cannot be enumerated
+// up front -- those of tenants in a multi-tenant service, for example. f is
+// consulted by OriginAllowed for origins not otherwise allowed. Like other
+// allowed origins, those allowed by f are reflected in
+// Access-Control-Allow-Origin, along with Vary: Origin; since the policy no
+// longer allows all origins, "*" is never sent, whether or not AllowCredentials
+// is set.
+func (c *CORSPolicy) AllowOriginFunc(f func(origin string) bool) {
+	c.allowAllOrigins = false
+	c.fixedOrigin = ""
+	c.allowOriginFunc = f
+}
+
+// AllowOriginFuncErr allows requests from any origin for which f returns
+// true, in addition to those allowed otherwise. f is given the whole request,
+// so that its decision may depend on the path or a tenant header, say, and
+// may return an error if it cannot decide -- because a backend lookup failed,
+// for example. Such errors are surfaced by CheckOrigin, and answered by the
+// policy's Middleware with ErrCORSOriginCheckFailed.
+func (c *CORSPolicy) AllowOriginFuncErr(f func(origin string, req *http.Request) (bool, error)) {
+	c.allowAllOrigins = false
+	c.fixedOrigin = ""
+	c.originFunc = f
+}
+
+// CheckOrigin indicates whether the origin of req is allowed by the policy,
+// returning any error from the function set with AllowOriginFuncErr. Requests
+// without an Origin are never allowed.
+func (c *CORSPolicy) CheckOrigin(req *http.Request) (bool, error) {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return false, nil
+	}
+	if c.OriginAllowed(origin) || c.sameOrigin(req, origin) {
+		return true, nil
+	}
+	if c.originFunc != nil {
+		return c.originFunc(origin, req)
+	}
+	return false, nil
+}
+
+// sameOrigin indicates whether origin is the server's own, if allowed by
+// AllowSameOrigin.
+func (c *CORSPolicy) sameOrigin(req *http.Request, origin string) bool {
+	if !c.allowSameOrigin {
+		return false
+	}
+	server := c.serverOrigin
+	if server == "" {
+		scheme := "http"
+		if req.TLS != nil {
+			scheme = "https"
+		}
+		server = scheme + "://" + req.Host
+	}
+	return strings.EqualFold(origin, server)
+}
+
+// indexOrigins rebuilds the set of allowed origins consulted by OriginAllowed
+// from the list of origins. The set allows origins to be checked in constant
+// time, however many are configured.
+func (c *CORSPolicy) indexOrigins() {
+	c.originSet = make(map[string]struct{}, len(c.origins))
+	for _, origin := range c.origins {
+		c.originSet[origin] = struct{}{}
+	}
 }
 
 func (c *CORSPolicy) AllowMethods(m ...string) {
@@ -53,6 +336,28 @@ func (c *CORSPolicy) AllowMethods(m ...string) {
 	c.methods = append(c.methods, m...)
 }
 
+// MethodAllowed indicates whether the policy allows requests using method, as
+// requested by a preflight's Access-Control-Request-Method. Methods are
+// compared case-sensitively. The CORS-safelisted methods -- GET, HEAD, and
+// POST -- are always allowed, as browsers allow them whatever the preflight
+// response; so is any method if none have been configured, or all are
+// allowed, and the empty method, for which there is nothing to check.
+func (c *CORSPolicy) MethodAllowed(method string) bool {
+	switch method {
+	case "", "GET", "HEAD", "POST":
+		return true
+	}
+	if c.allowAllMethods || len(c.methods) == 0 {
+		return true
+	}
+	for _, m := range c.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *CORSPolicy) AllowAllMethods() {
 	c.allowAllMethods = true
 	c.methods = []string{}
@@ -72,56 +377,455 @@ func (c *CORSPolicy) ExposeHeaders(h ...string) {
 	c.exposeHeaders = append(c.exposeHeaders, h...)
 }
 
+// ExposeAllHeaders exposes every response header by way of the "*" wildcard.
+// Headers passed to ExposeHeaders continue to be listed after the wildcard,
+// as in "*, Authorization", so that those which the wildcard doesn't cover --
+// such as Authorization -- may also be exposed. Browsers don't honor the
+// wildcard in responses to credentialed requests, so it is omitted when
+// AllowCredentials is set, leaving only the headers listed explicitly.
+func (c *CORSPolicy) ExposeAllHeaders() {
+	c.exposeAllHeaders = true
+}
+
+// AllowCredentialsForMethods allows credentials only for requests using one of
+// the given methods -- GET, say, but not mutating methods such as DELETE --
+// unless AllowCredentials allows them for all requests. The method of a
+// preflight request is the one it requests, in Access-Control-Request-Method,
+// on which preflight responses then vary. Methods are case-sensitive.
+func (c *CORSPolicy) AllowCredentialsForMethods(methods ...string) {
+	c.credsMethods = append(c.credsMethods, methods...)
+}
+
+// credentialsAllowed indicates whether the policy allows credentials for req.
+func (c *CORSPolicy) credentialsAllowed(req *http.Request, preflight bool) bool {
+	if c.AllowCredentials {
+		return true
+	}
+	method := req.Method
+	if preflight {
+		method = req.Header.Get("Access-Control-Request-Method")
+	}
+	for _, m := range c.credsMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the policy's configuration, so that mistakes may be found at
+// startup rather than one request at a time. It returns nil if the policy is
+// valid, and otherwise an error joining (as with errors.Join) one error for
+// each problem found, each of which wraps one of:
+//
+//   - ErrCORSInvalidHeaderName, for an allowed or exposed header name which
+//     isn't a valid HTTP token -- one containing a space, for example.
+//     Browsers reject preflight responses listing such names, so that an
+//     invalid name silently breaks every request relying on the preflight;
+//   - ErrCORSInvalidOrigin, for an allowed origin which isn't of the form
+//     "scheme://host[:port]" (or "null"), such as one with a trailing slash,
+//     which no request's Origin would ever match;
+//   - ErrCORSWildcardCredentials, if credentials are allowed from any origin;
+//   - ErrCORSNoOrigins, if StrictReject is set but no origin can be allowed.
+//
+// Each problem may be tested for with errors.Is.
+func (c *CORSPolicy) Validate() error {
+	var errs []error
+	for _, names := range [][]string{c.allowHeaders, c.exposeHeaders} {
+		for _, name := range names {
+			if !isHeaderToken(name) {
+				errs = append(errs, fmt.Errorf("%w: %q", ErrCORSInvalidHeaderName, name))
+			}
+		}
+	}
+	for _, origin := range c.origins {
+		if _, _, _, ok := splitOrigin(origin); !ok && origin != "null" {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrCORSInvalidOrigin, origin))
+		}
+	}
+	if c.allowAllOrigins && (c.AllowCredentials || len(c.credsMethods) > 0) {
+		errs = append(errs, ErrCORSWildcardCredentials)
+	}
+	if c.StrictReject && !c.allowAllOrigins && len(c.origins) == 0 && len(c.originPatterns) == 0 &&
+		!c.allowSameOrigin && c.allowOriginFunc == nil && c.originFunc == nil {
+		errs = append(errs, ErrCORSNoOrigins)
+	}
+	return errors.Join(errs...)
+}
+
+// isHeaderToken indicates whether s is a valid HTTP token, as required of
+// header names.
+func isHeaderToken(s string) bool {
+	token, rest := expectToken(s)
+	return token != "" && rest == ""
+}
+
+// Merge returns a new policy combining c with other, such as a global policy
+// with one specific to a route. Neither policy is modified. The merged policy:
+//
+//   - allows the union of the origins, methods, and headers allowed by each,
+//     and allows all of them if either does;
+//   - allows origins matching the patterns of each;
+//   - emits a fixed origin, as set by AllowFixedOrigin, only if the merged
+//     policy allows that origin alone;
+//   - allows the server's own origin if either does, taking the server's
+//     origin from other if it allows it;
+//   - consults the origin functions of other if set, and those of c
+//     otherwise;
+//   - allows credentials for the union of the methods for which each allows
+//     them;
+//   - exposes the union of the headers exposed by each, and all headers if
+//     either does;
+//   - takes MaxAge, PreflightContinue, PostWrite, and Responder from other when they are
+//     set (non-zero), and from c otherwise;
+//   - enables AllowCredentials, ReflectRequestHeaders, AlwaysSendHeaders,
+//     DeferCredentials, and StrictReject if either policy enables them. Since a boolean which is
+//     false cannot be distinguished from one which is unset, other can enable
+//     these settings, but not disable them.
+func (c *CORSPolicy) Merge(other *CORSPolicy) *CORSPolicy {
+	m := &CORSPolicy{
+		allowAllOrigins:  c.allowAllOrigins || other.allowAllOrigins,
+		allowAllMethods:  c.allowAllMethods || other.allowAllMethods,
+		allowAllHeaders:  c.allowAllHeaders || other.allowAllHeaders,
+		exposeAllHeaders: c.exposeAllHeaders || other.exposeAllHeaders,
+		exposeHeaders:    unionStrings(c.exposeHeaders, other.exposeHeaders),
+
+		allowSameOrigin: c.allowSameOrigin || other.allowSameOrigin,
+		serverOrigin:    c.serverOrigin,
+		allowOriginFunc: c.allowOriginFunc,
+		originFunc:      c.originFunc,
+
+		MaxAge:                c.MaxAge,
+		AllowCredentials:      c.AllowCredentials || other.AllowCredentials,
+		credsMethods:          unionStrings(c.credsMethods, other.credsMethods),
+		ReflectRequestHeaders: c.ReflectRequestHeaders || other.ReflectRequestHeaders,
+		AlwaysSendHeaders:     c.AlwaysSendHeaders || other.AlwaysSendHeaders,
+		DeferCredentials:      c.DeferCredentials || other.DeferCredentials,
+		PreflightContinue:     c.PreflightContinue,
+		PostWrite:             c.PostWrite,
+		StrictReject:          c.StrictReject || other.StrictReject,
+		Responder:             c.Responder,
+	}
+	if other.allowOriginFunc != nil {
+		m.allowOriginFunc = other.allowOriginFunc
+	}
+	if other.originFunc != nil {
+		m.originFunc = other.originFunc
+	}
+	if !m.allowAllOrigins {
+		m.origins = unionStrings(c.origins, other.origins)
+		m.indexOrigins()
+		m.originPatterns = append(append([]originPattern(nil), c.originPatterns...), other.originPatterns...)
+		alone := len(m.origins) == 1 && len(m.originPatterns) == 0 &&
+			m.allowOriginFunc == nil && m.originFunc == nil
+		if alone && (m.origins[0] == c.fixedOrigin || m.origins[0] == other.fixedOrigin) {
+			m.fixedOrigin = m.origins[0]
+		}
+	}
+	if !m.allowAllMethods {
+		m.methods = unionStrings(c.methods, other.methods)
+	}
+	if !m.allowAllHeaders {
+		m.allowHeaders = unionStrings(c.allowHeaders, other.allowHeaders)
+	}
+	if other.allowSameOrigin {
+		m.serverOrigin = other.serverOrigin
+	}
+	if other.MaxAge != 0 {
+		m.MaxAge = other.MaxAge
+	}
+	if other.PreflightContinue != nil {
+		m.PreflightContinue = other.PreflightContinue
+	}
+	if other.PostWrite != nil {
+		m.PostWrite = other.PostWrite
+	}
+	if other.Responder != nil {
+		m.Responder = other.Responder
+	}
+	return m
+}
+
+// Clone returns a deep copy of c, which may be configured further -- as a
+// variant of a shared policy for a particular route, for example -- without
+// affecting c. Functions and the Responder are shared with c.
+func (c *CORSPolicy) Clone() *CORSPolicy {
+	n := *c
+	n.origins = append([]string(nil), c.origins...)
+	n.indexOrigins()
+	n.originPatterns = append([]originPattern(nil), c.originPatterns...)
+	n.methods = append([]string(nil), c.methods...)
+	n.allowHeaders = append([]string(nil), c.allowHeaders...)
+	n.exposeHeaders = append([]string(nil), c.exposeHeaders...)
+	n.credsMethods = append([]string(nil), c.credsMethods...)
+	return &n
+}
+
+// unionStrings returns the distinct elements of a followed by those of b, in
+// the order in which they first appear.
+func unionStrings(a, b []string) []string {
+	seen := make(map[string]struct{}, len(a)+len(b))
+	u := make([]string, 0, len(a)+len(b))
+	for _, l := range [][]string{a, b} {
+		for _, s := range l {
+			if _, ok := seen[s]; ok {
+				continue
+			}
+			seen[s] = struct{}{}
+			u = append(u, s)
+		}
+	}
+	return u
+}
+
 func (c *CORSPolicy) OriginAllowed(o string) bool {
 	if c.allowAllOrigins {
 		return true
 	}
-	for _, origin := range c.origins {
-		if o == origin {
+	if _, ok := c.originSet[o]; ok {
+		return true
+	}
+	for _, p := range c.originPatterns {
+		if p.match(o) {
 			return true
 		}
 	}
-	return false
+	return c.allowOriginFunc != nil && c.allowOriginFunc(o)
 }
 
-// TODO(kk): Optimize this by joining strings and fomratting numbers ahead of time.
+// corsHeaders holds the values of the headers written by WriteHeaders which
+// may depend on the request.
+type corsHeaders struct {
+	allowOrigin  string
+	allowMethods string
+	allowHeaders string
+	vary         []string
+}
+
+// credentialsSafe replaces any wildcard values, which browsers reject in
+// responses to credentialed requests, with the explicit values they would
+// have matched for req: its origin, requested method, and requested headers.
+func (h *corsHeaders) credentialsSafe(req *http.Request) {
+	if h.allowOrigin == "*" {
+		h.allowOrigin = req.Header.Get("Origin")
+		if h.allowOrigin == "" {
+			h.allowOrigin = "null"
+		}
+		h.vary = append(h.vary, "Origin")
+	}
+	if h.allowMethods == "*" {
+		h.allowMethods = req.Header.Get("Access-Control-Request-Method")
+		h.vary = append(h.vary, "Access-Control-Request-Method")
+	}
+	if h.allowHeaders == "*" {
+		h.allowHeaders = req.Header.Get("Access-Control-Request-Headers")
+		h.vary = append(h.vary, "Access-Control-Request-Headers")
+	}
+}
+
+// WriteHeaders writes the CORS headers for req to w: those of
+// WritePreflightHeaders if req is a preflight request -- an OPTIONS request
+// carrying Access-Control-Request-Method -- and those of WriteActualHeaders
+// otherwise. Should CheckOrigin fail for req, its origin is treated as
+// disallowed; use CheckOrigin, or the policy's Middleware, to surface the
+// error.
+//
+// WriteHeaders, like the policy's other Write methods and its Middleware,
+// doesn't modify the policy, and so may be called concurrently once the
+// policy has been configured. Use Clone to derive a policy to configure
+// further.
 func (c *CORSPolicy) WriteHeaders(w http.ResponseWriter, req *http.Request) {
-	// write Access-Control-Allow-Origin
+	allowed, _ := c.CheckOrigin(req)
+	c.writeHeaders(w, req, allowed, isPreflight(req))
+}
+
+// WritePreflightHeaders writes the headers answering a preflight request to
+// w: Access-Control-Allow-Origin and Access-Control-Allow-Credentials, along
+// with Access-Control-Allow-Methods, Access-Control-Allow-Headers, and
+// Access-Control-Max-Age, which are meaningful only in preflight responses.
+// If the method requested by the preflight isn't allowed (see MethodAllowed),
+// no headers are written, so that the browser blocks the request.
+func (c *CORSPolicy) WritePreflightHeaders(w http.ResponseWriter, req *http.Request) {
+	allowed, _ := c.CheckOrigin(req)
+	c.writeHeaders(w, req, allowed, true)
+}
+
+// WriteActualHeaders writes the headers for the response to an actual
+// (non-preflight) request to w: Access-Control-Allow-Origin,
+// Access-Control-Allow-Credentials, and Access-Control-Expose-Headers.
+func (c *CORSPolicy) WriteActualHeaders(w http.ResponseWriter, req *http.Request) {
+	allowed, _ := c.CheckOrigin(req)
+	c.writeHeaders(w, req, allowed, false)
+}
+
+// TODO(kk): Optimize this by joining strings and fomratting numbers ahead of time.
+func (c *CORSPolicy) writeHeaders(w http.ResponseWriter, req *http.Request, allowed, preflight bool) {
+	// requests without an Origin aren't cross-origin requests made by a browser
+	if req.Header.Get("Origin") == "" && !c.AlwaysSendHeaders {
+		return
+	}
+	// a preflight for a method which isn't allowed receives no CORS headers,
+	// so that the browser blocks the request
+	if preflight && !c.MethodAllowed(req.Header.Get("Access-Control-Request-Method")) {
+		return
+	}
+	var h corsHeaders
+	// determine Access-Control-Allow-Origin
 	if c.allowAllOrigins {
-		w.Header().Set(HeaderNameCORSAllowOrigin, "*")
+		h.allowOrigin = "*"
+	} else if c.fixedOrigin != "" {
+		// the same for every request, so there's nothing to vary on
+		h.allowOrigin = c.fixedOrigin
 	} else {
-		if len(c.origins) > 1 {
-			w.Header().Set(HeaderNameCORSVary, "Origin")
+		// the response depends on the request's Origin whenever it isn't a
+		// wildcard, however many origins are configured
+		h.vary = append(h.vary, "Origin")
+		if allowed {
+			h.allowOrigin = req.Header.Get("Origin")
+		} else {
+			h.allowOrigin = "null"
 		}
-		origin := req.Header.Get("Origin")
-		if c.OriginAllowed(origin) {
-			w.Header().Set(HeaderNameCORSAllowOrigin, origin)
+	}
+	if preflight {
+		// determine Access-Control-Allow-Methods
+		if c.allowAllMethods {
+			h.allowMethods = "*"
 		} else {
-			w.Header().Set(HeaderNameCORSAllowOrigin, "null")
+			h.allowMethods = strings.Join(c.methods, ", ")
 		}
+		// determine Access-Control-Allow-Headers
+		if c.ReflectRequestHeaders {
+			h.allowHeaders = req.Header.Get("Access-Control-Request-Headers")
+			h.vary = append(h.vary, "Access-Control-Request-Headers")
+		} else if c.allowAllHeaders {
+			h.allowHeaders = "*"
+		} else {
+			h.allowHeaders = strings.Join(c.allowHeaders, ", ")
+		}
+	}
+	// wildcards are not permitted in responses allowing credentials, whether
+	// the policy allows them or an upstream value is deferred to; browsers
+	// reject "*" alongside Access-Control-Allow-Credentials: true
+	allowCreds := c.credentialsAllowed(req, preflight)
+	if preflight && !c.AllowCredentials && len(c.credsMethods) > 0 {
+		h.vary = append(h.vary, "Access-Control-Request-Method")
 	}
+	credentialed := allowCreds ||
+		(c.DeferCredentials && w.Header().Get(HeaderNameCORSAllowCreds) == "true")
+	if credentialed {
+		h.credentialsSafe(req)
+	}
+
+	// write Vary, preserving any values set by other middleware
+	if len(h.vary) > 0 {
+		mergeVary(w.Header(), h.vary)
+	}
+	// write Access-Control-Allow-Origin
+	w.Header().Set(HeaderNameCORSAllowOrigin, h.allowOrigin)
 	// write Access-Control-Expose-Headers
-	if len(c.exposeHeaders) > 0 {
-		w.Header().Set(HeaderNameCORSExposeHeaders, strings.Join(c.exposeHeaders, ", "))
+	if expose := c.exposedHeaders(credentialed); expose != "" && !preflight {
+		w.Header().Set(HeaderNameCORSExposeHeaders, expose)
 	}
 	// write Access-Control-Max-Age
-	w.Header().Set(HeaderNameCORSMaxAge, fmt.Sprintf("%d", int(c.MaxAge.Seconds())))
+	if preflight {
+		w.Header().Set(HeaderNameCORSMaxAge, fmt.Sprintf("%d", int(c.MaxAge.Seconds())))
+	}
 	// write Access-Control-Allow-Credentials
-	if c.AllowCredentials {
+	if c.DeferCredentials && w.Header().Get(HeaderNameCORSAllowCreds) != "" {
+		// leave the upstream value in place
+	} else if allowCreds {
 		w.Header().Set(HeaderNameCORSAllowCreds, "true")
 	} else {
 		w.Header().Set(HeaderNameCORSAllowCreds, "false")
 	}
 	// write Access-Control-Allow-Methods
-	if c.allowAllMethods {
-		w.Header().Set(HeaderNameCORSAllowMethods, "*")
-	} else if len(c.methods) > 0 {
-		w.Header().Set(HeaderNameCORSAllowMethods, strings.Join(c.methods, ", "))
+	if h.allowMethods != "" {
+		w.Header().Set(HeaderNameCORSAllowMethods, h.allowMethods)
 	}
 	// write Access-Control-Allow-Headers
-	if c.allowAllHeaders {
-		w.Header().Set(HeaderNameCORSAllowHeaders, "*")
-	} else if len(c.allowHeaders) > 0 {
-		w.Header().Set(HeaderNameCORSAllowHeaders, strings.Join(c.allowHeaders, ", "))
+	if h.allowHeaders != "" {
+		w.Header().Set(HeaderNameCORSAllowHeaders, h.allowHeaders)
+	}
+	if c.PostWrite != nil {
+		c.PostWrite(w, req)
 	}
 }
+
+// exposedHeaders returns the value of Access-Control-Expose-Headers: the
+// wildcard, if all headers are exposed and credentials are not allowed,
+// followed by any listed explicitly.
+func (c *CORSPolicy) exposedHeaders(credentialed bool) string {
+	if c.exposeAllHeaders && !credentialed {
+		return strings.Join(append([]string{"*"}, c.exposeHeaders...), ", ")
+	}
+	return strings.Join(c.exposeHeaders, ", ")
+}
+
+// mergeVary adds values to the Vary header of h, alongside those already
+// present, omitting duplicates. Header names are compared case-insensitively.
+func mergeVary(h http.Header, values []string) {
+	var merged []string
+	seen := make(map[string]bool)
+	add := func(v string) {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[strings.ToLower(v)] {
+			return
+		}
+		seen[strings.ToLower(v)] = true
+		merged = append(merged, v)
+	}
+	for _, line := range h.Values(HeaderNameCORSVary) {
+		for _, v := range strings.Split(line, ",") {
+			add(v)
+		}
+	}
+	if seen["*"] {
+		// the response already varies on everything
+		return
+	}
+	for _, v := range values {
+		add(v)
+	}
+	h.Set(HeaderNameCORSVary, strings.Join(merged, ", "))
+}
+
+// Middleware returns middleware which writes CORS headers for every request,
+// for registration with middleware.Set.Use. Preflight requests -- OPTIONS
+// requests carrying Access-Control-Request-Method -- are answered with 204 No
+// Content, without invoking the rest of the chain; other OPTIONS requests are
+// passed through. If StrictReject is set, requests from disallowed origins
+// are answered with ErrCORSOriginDenied. Requests whose origin cannot be
+// checked, because the function set with AllowOriginFuncErr fails, are
+// answered with ErrCORSOriginCheckFailed.
+func (c *CORSPolicy) Middleware() middleware.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			allowed, err := c.CheckOrigin(req)
+			if err != nil {
+				WriteError(w, req, c.Responder, ErrCORSOriginCheckFailed)
+				return
+			}
+			if c.StrictReject && req.Header.Get("Origin") != "" && !allowed {
+				WriteError(w, req, c.Responder, ErrCORSOriginDenied)
+				return
+			}
+			preflight := isPreflight(req)
+			c.writeHeaders(w, req, allowed, preflight)
+			if !preflight {
+				next.ServeHTTP(w, req)
+				return
+			}
+			if c.PreflightContinue != nil && !c.PreflightContinue(w, req) {
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// isPreflight indicates whether req is a CORS preflight request.
+func isPreflight(req *http.Request) bool {
+	return req.Method == "OPTIONS" &&
+		req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
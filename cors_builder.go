@@ -0,0 +1,82 @@
+package httpext
+
+import (
+	"time"
+)
+
+// CORSBuilder configures a CORSPolicy in a single expression, by way of
+// chained calls to methods corresponding to the options accepted by
+// NewCORSPolicy:
+//
+//	policy := NewCORSBuilder().
+//		WithOrigins("https://example.com").
+//		WithMethods("GET", "POST").
+//		WithCredentials(true).
+//		WithMaxAge(time.Hour).
+//		Build()
+type CORSBuilder struct {
+	policy CORSPolicy
+}
+
+// NewCORSBuilder returns a builder for a policy which, until configured,
+// allows nothing.
+func NewCORSBuilder() *CORSBuilder {
+	return &CORSBuilder{}
+}
+
+// WithOrigins applies the WithOrigins option.
+func (b *CORSBuilder) WithOrigins(o ...string) *CORSBuilder {
+	return b.apply(WithOrigins(o...))
+}
+
+// WithAllOrigins applies the WithAllOrigins option.
+func (b *CORSBuilder) WithAllOrigins() *CORSBuilder {
+	return b.apply(WithAllOrigins())
+}
+
+// WithMethods applies the WithMethods option.
+func (b *CORSBuilder) WithMethods(m ...string) *CORSBuilder {
+	return b.apply(WithMethods(m...))
+}
+
+// WithAllMethods applies the WithAllMethods option.
+func (b *CORSBuilder) WithAllMethods() *CORSBuilder {
+	return b.apply(WithAllMethods())
+}
+
+// WithHeaders applies the WithHeaders option.
+func (b *CORSBuilder) WithHeaders(h ...string) *CORSBuilder {
+	return b.apply(WithHeaders(h...))
+}
+
+// WithAllHeaders applies the WithAllHeaders option.
+func (b *CORSBuilder) WithAllHeaders() *CORSBuilder {
+	return b.apply(WithAllHeaders())
+}
+
+// WithExposedHeaders applies the WithExposedHeaders option.
+func (b *CORSBuilder) WithExposedHeaders(h ...string) *CORSBuilder {
+	return b.apply(WithExposedHeaders(h...))
+}
+
+// WithCredentials applies the WithCredentials option.
+func (b *CORSBuilder) WithCredentials(allow bool) *CORSBuilder {
+	return b.apply(WithCredentials(allow))
+}
+
+// WithMaxAge applies the WithMaxAge option.
+func (b *CORSBuilder) WithMaxAge(d time.Duration) *CORSBuilder {
+	return b.apply(WithMaxAge(d))
+}
+
+// apply configures the policy being built with opt.
+func (b *CORSBuilder) apply(opt CORSOption) *CORSBuilder {
+	opt(&b.policy)
+	return b
+}
+
+// Build returns the configured policy. The builder may continue to be used
+// afterwards without affecting policies it has already built.
+func (b *CORSBuilder) Build() *CORSPolicy {
+	return b.policy.Clone()
+}
@@ -0,0 +1,62 @@
+package httpext
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSBuilder(t *testing.T) {
+	b := NewCORSBuilder().
+		WithOrigins("http://example.com").
+		WithMethods("GET", "POST").
+		WithHeaders("X-Test-Header").
+		WithExposedHeaders("X-Exposed-Header").
+		WithCredentials(true).
+		WithMaxAge(time.Minute)
+	c := b.Build()
+
+	req, _ := http.NewRequest("OPTIONS", "/example", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	c.WriteHeaders(w, req)
+
+	assert.Equal(t, "http://example.com", w.Header().Get(HeaderNameCORSAllowOrigin),
+		"Configured origin should be allowed.")
+	assert.Equal(t, "GET, POST", w.Header().Get(HeaderNameCORSAllowMethods),
+		"Configured methods should be allowed.")
+	assert.Equal(t, "X-Test-Header", w.Header().Get(HeaderNameCORSAllowHeaders),
+		"Configured headers should be allowed.")
+	assert.Equal(t, "true", w.Header().Get(HeaderNameCORSAllowCreds),
+		"Credentials should be allowed.")
+	assert.Equal(t, "60", w.Header().Get(HeaderNameCORSMaxAge),
+		"Max age should be configured.")
+
+	w = httptest.NewRecorder()
+	c.WriteActualHeaders(w, req)
+	assert.Equal(t, "X-Exposed-Header", w.Header().Get(HeaderNameCORSExposeHeaders),
+		"Configured headers should be exposed.")
+
+	b.WithOrigins("http://another.com")
+	assert.False(t, c.OriginAllowed("http://another.com"),
+		"Policies already built should not be affected by further configuration.")
+	assert.True(t, b.Build().OriginAllowed("http://another.com"),
+		"Further configuration should apply to subsequently built policies.")
+}
+
+func TestCORSBuilderWildcards(t *testing.T) {
+	c := NewCORSBuilder().WithAllOrigins().WithAllMethods().WithAllHeaders().Build()
+	assert.True(t, c.OriginAllowed("http://anywhere.com"), "All origins should be allowed.")
+
+	req, _ := http.NewRequest("OPTIONS", "/example", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	w := httptest.NewRecorder()
+	c.WriteHeaders(w, req)
+	assert.Equal(t, "*", w.Header().Get(HeaderNameCORSAllowMethods), "All methods should be allowed.")
+	assert.Equal(t, "*", w.Header().Get(HeaderNameCORSAllowHeaders), "All headers should be allowed.")
+}
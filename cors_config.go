@@ -0,0 +1,77 @@
+package httpext
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCORSConflictingConfig is reported by CORSConfig.Policy for a
+// configuration which enables mutually-exclusive settings, such as
+// AllowAllOrigins along with a list of AllowedOrigins.
+var ErrCORSConflictingConfig = errors.New("conflicting CORS configuration")
+
+// CORSConfig declares a CORSPolicy, such that one may be loaded from a
+// configuration file:
+//
+//	{
+//	  "allowed_origins": ["https://example.com"],
+//	  "allowed_methods": ["GET", "POST"],
+//	  "max_age_seconds": 3600,
+//	  "allow_credentials": true
+//	}
+//
+// Use Policy to construct the policy it declares.
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins,omitempty"`
+	AllowAllOrigins  bool     `json:"allow_all_origins,omitempty"`
+	AllowedMethods   []string `json:"allowed_methods,omitempty"`
+	AllowAllMethods  bool     `json:"allow_all_methods,omitempty"`
+	AllowedHeaders   []string `json:"allowed_headers,omitempty"`
+	ExposedHeaders   []string `json:"exposed_headers,omitempty"`
+	MaxAgeSeconds    int      `json:"max_age_seconds,omitempty"`
+	AllowCredentials bool     `json:"allow_credentials,omitempty"`
+}
+
+// Policy returns the policy declared by cfg. Rather than letting one setting
+// silently override another, Policy reports an error wrapping
+// ErrCORSConflictingConfig should both AllowAllOrigins and AllowedOrigins, or
+// both AllowAllMethods and AllowedMethods, be set, or MaxAgeSeconds be
+// negative. The policy must also pass Validate; in particular, credentials
+// cannot be allowed for all origins. Every problem found is reported.
+func (cfg CORSConfig) Policy() (*CORSPolicy, error) {
+	var errs []error
+	if cfg.AllowAllOrigins && len(cfg.AllowedOrigins) > 0 {
+		errs = append(errs, fmt.Errorf("%w: allow_all_origins with allowed_origins", ErrCORSConflictingConfig))
+	}
+	if cfg.AllowAllMethods && len(cfg.AllowedMethods) > 0 {
+		errs = append(errs, fmt.Errorf("%w: allow_all_methods with allowed_methods", ErrCORSConflictingConfig))
+	}
+	if cfg.MaxAgeSeconds < 0 {
+		errs = append(errs, fmt.Errorf("%w: negative max_age_seconds %d", ErrCORSConflictingConfig, cfg.MaxAgeSeconds))
+	}
+
+	c := &CORSPolicy{
+		MaxAge:           time.Duration(cfg.MaxAgeSeconds) * time.Second,
+		AllowCredentials: cfg.AllowCredentials,
+	}
+	if cfg.AllowAllOrigins {
+		c.AllowAllOrigins()
+	} else {
+		c.AllowOrigins(cfg.AllowedOrigins...)
+	}
+	if cfg.AllowAllMethods {
+		c.AllowAllMethods()
+	} else {
+		c.AllowMethods(cfg.AllowedMethods...)
+	}
+	c.AllowHeaders(cfg.AllowedHeaders...)
+	c.ExposeHeaders(cfg.ExposedHeaders...)
+	if err := c.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,70 @@
+package httpext
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSConfigPolicy(t *testing.T) {
+	var cfg CORSConfig
+	err := json.Unmarshal([]byte(`{
+		"allowed_origins": ["https://example.com"],
+		"allowed_methods": ["GET", "POST"],
+		"allowed_headers": ["X-Test-Header"],
+		"exposed_headers": ["X-Count"],
+		"max_age_seconds": 3600,
+		"allow_credentials": true
+	}`), &cfg)
+	assert.NoError(t, err)
+
+	c, err := cfg.Policy()
+	assert.NoError(t, err)
+	assert.True(t, c.OriginAllowed("https://example.com"))
+	assert.False(t, c.OriginAllowed("https://other.example.com"))
+	assert.Equal(t, time.Hour, c.MaxAge)
+
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	c.WriteHeaders(w, req)
+	assert.Equal(t, "https://example.com", w.Header().Get(HeaderNameCORSAllowOrigin))
+	assert.Equal(t, "GET, POST", w.Header().Get(HeaderNameCORSAllowMethods))
+	assert.Equal(t, "X-Test-Header", w.Header().Get(HeaderNameCORSAllowHeaders))
+	assert.Equal(t, "3600", w.Header().Get(HeaderNameCORSMaxAge))
+	assert.Equal(t, "true", w.Header().Get(HeaderNameCORSAllowCreds))
+
+	c, err = CORSConfig{AllowAllOrigins: true, AllowAllMethods: true}.Policy()
+	assert.NoError(t, err)
+	assert.True(t, c.OriginAllowed("https://any.example.com"))
+	assert.True(t, c.MethodAllowed("DELETE"))
+}
+
+func TestCORSConfigPolicyInvalid(t *testing.T) {
+	c, err := CORSConfig{AllowAllOrigins: true, AllowCredentials: true}.Policy()
+	assert.Nil(t, c)
+	assert.ErrorIs(t, err, ErrCORSWildcardCredentials,
+		"Credentials should not be allowed for all origins.")
+
+	c, err = CORSConfig{
+		AllowedOrigins:  []string{"https://example.com"},
+		AllowAllOrigins: true,
+		AllowedMethods:  []string{"GET"},
+		AllowAllMethods: true,
+		AllowedHeaders:  []string{"X Bad Header"},
+		MaxAgeSeconds:   -1,
+	}.Policy()
+	assert.Nil(t, c)
+	assert.ErrorIs(t, err, ErrCORSConflictingConfig)
+	assert.ErrorIs(t, err, ErrCORSInvalidHeaderName)
+	assert.Contains(t, err.Error(), "allow_all_origins", "Every problem should be reported.")
+	assert.Contains(t, err.Error(), "allow_all_methods", "Every problem should be reported.")
+	assert.Contains(t, err.Error(), "max_age_seconds", "Every problem should be reported.")
+
+	_, err = CORSConfig{AllowedOrigins: []string{"example.com"}}.Policy()
+	assert.ErrorIs(t, err, ErrCORSInvalidOrigin)
+}
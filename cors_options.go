@@ -0,0 +1,79 @@
+package httpext
+
+import (
+	"time"
+)
+
+// CORSOption configures a CORSPolicy created by NewCORSPolicy.
+type CORSOption func(*CORSPolicy)
+
+// NewCORSPolicy returns a policy configured by opts, applied in order, such
+// that a reusable policy may be declared in a single expression:
+//
+//	var apiCORS = NewCORSPolicy(
+//		WithOrigins("https://example.com"),
+//		WithMethods("GET", "POST"),
+//		WithCredentials(true),
+//		WithMaxAge(time.Hour),
+//	)
+//
+// Without options, the policy allows nothing. CORSBuilder offers the same
+// options as chained methods.
+func NewCORSPolicy(opts ...CORSOption) *CORSPolicy {
+	c := &CORSPolicy{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithOrigins adds to the origins from which requests are allowed, as with
+// CORSPolicy.AllowOrigins.
+func WithOrigins(o ...string) CORSOption {
+	return func(c *CORSPolicy) { c.AllowOrigins(o...) }
+}
+
+// WithAllOrigins allows requests from any origin, replacing any origins
+// allowed by earlier options.
+func WithAllOrigins() CORSOption {
+	return func(c *CORSPolicy) { c.AllowAllOrigins() }
+}
+
+// WithMethods adds to the methods which may be requested by preflights, as
+// with CORSPolicy.AllowMethods.
+func WithMethods(m ...string) CORSOption {
+	return func(c *CORSPolicy) { c.AllowMethods(m...) }
+}
+
+// WithAllMethods allows preflights to request any method.
+func WithAllMethods() CORSOption {
+	return func(c *CORSPolicy) { c.AllowAllMethods() }
+}
+
+// WithHeaders adds to the request headers listed in
+// Access-Control-Allow-Headers.
+func WithHeaders(h ...string) CORSOption {
+	return func(c *CORSPolicy) { c.AllowHeaders(h...) }
+}
+
+// WithAllHeaders allows requests to carry any header.
+func WithAllHeaders() CORSOption {
+	return func(c *CORSPolicy) { c.AllowAllHeaders() }
+}
+
+// WithExposedHeaders adds to the response headers listed in
+// Access-Control-Expose-Headers, which scripts are permitted to read.
+func WithExposedHeaders(h ...string) CORSOption {
+	return func(c *CORSPolicy) { c.ExposeHeaders(h...) }
+}
+
+// WithCredentials sets the policy's AllowCredentials.
+func WithCredentials(allow bool) CORSOption {
+	return func(c *CORSPolicy) { c.AllowCredentials = allow }
+}
+
+// WithMaxAge sets the policy's MaxAge, the time for which browsers may cache
+// the response to a preflight.
+func WithMaxAge(d time.Duration) CORSOption {
+	return func(c *CORSPolicy) { c.MaxAge = d }
+}
@@ -0,0 +1,46 @@
+package httpext
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCORSPolicy(t *testing.T) {
+	c := NewCORSPolicy(
+		WithOrigins("http://example.com"),
+		WithMethods("GET", "PUT"),
+		WithHeaders("X-Test-Header"),
+		WithExposedHeaders("X-Exposed-Header"),
+		WithCredentials(true),
+		WithMaxAge(time.Minute),
+	)
+	assert.True(t, c.OriginAllowed("http://example.com"))
+	assert.False(t, c.OriginAllowed("http://another.com"))
+
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	w := httptest.NewRecorder()
+	c.WriteHeaders(w, req)
+	assert.Equal(t, "http://example.com", w.Header().Get(HeaderNameCORSAllowOrigin))
+	assert.Equal(t, "GET, PUT", w.Header().Get(HeaderNameCORSAllowMethods))
+	assert.Equal(t, "X-Test-Header", w.Header().Get(HeaderNameCORSAllowHeaders))
+	assert.Equal(t, "true", w.Header().Get(HeaderNameCORSAllowCreds))
+	assert.Equal(t, "60", w.Header().Get(HeaderNameCORSMaxAge))
+
+	w = httptest.NewRecorder()
+	c.WriteActualHeaders(w, req)
+	assert.Equal(t, "X-Exposed-Header", w.Header().Get(HeaderNameCORSExposeHeaders))
+}
+
+func TestNewCORSPolicyWildcards(t *testing.T) {
+	c := NewCORSPolicy(WithAllOrigins(), WithAllMethods(), WithAllHeaders())
+	assert.True(t, c.OriginAllowed("http://anywhere.com"))
+	assert.True(t, c.MethodAllowed("DELETE"))
+
+	empty := NewCORSPolicy()
+	assert.False(t, empty.OriginAllowed("http://anywhere.com"), "Policies without options should allow nothing.")
+}
@@ -0,0 +1,58 @@
+package httpext
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	// corsCommonMethods are the methods allowed by the preset policies.
+	corsCommonMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+	// corsCommonHeaders are the request headers allowed by the preset
+	// policies.
+	corsCommonHeaders = []string{"Accept", "Authorization", "Content-Type", "X-Requested-With"}
+)
+
+// DevCORSPolicy returns a permissive policy suitable for local development: it
+// allows requests from any origin, using common methods and headers, but
+// without credentials.
+func DevCORSPolicy() *CORSPolicy {
+	return NewCORSBuilder().
+		WithAllOrigins().
+		WithMethods(corsCommonMethods...).
+		WithHeaders(corsCommonHeaders...).
+		Build()
+}
+
+// StrictCORSPolicy returns a policy suitable for production, which allows
+// credentialed requests using common methods and headers from the given
+// origins only. Requests from other origins are rejected with
+// ErrCORSOriginDenied, and responses vary by Origin so that they are cached
+// correctly. Preflight responses may be cached for ten minutes.
+//
+// StrictCORSPolicy returns an error if no origins are given, if any origin is
+// the wildcard "*" (which browsers don't honor for credentialed requests), or
+// if the resulting policy fails Validate.
+func StrictCORSPolicy(origins ...string) (*CORSPolicy, error) {
+	if len(origins) == 0 {
+		return nil, fmt.Errorf("%w: no origins given", ErrCORSInvalidOrigin)
+	}
+	for _, o := range origins {
+		if o == "" || o == "*" {
+			return nil, fmt.Errorf("%w: %q", ErrCORSInvalidOrigin, o)
+		}
+	}
+	c := NewCORSBuilder().
+		WithOrigins(origins...).
+		WithMethods(corsCommonMethods...).
+		WithHeaders(corsCommonHeaders...).
+		WithCredentials(true).
+		WithMaxAge(10 * time.Minute).
+		Build()
+	c.StrictReject = true
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,52 @@
+package httpext
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func presetRequest(origin string) *http.Request {
+	req, _ := http.NewRequest("OPTIONS", "/example", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	return req
+}
+
+func TestDevCORSPolicy(t *testing.T) {
+	w := httptest.NewRecorder()
+	DevCORSPolicy().WriteHeaders(w, presetRequest("http://localhost:3000"))
+
+	assert.Equal(t, "*", w.Header().Get(HeaderNameCORSAllowOrigin),
+		"Any origin should be allowed.")
+	assert.Equal(t, "GET, HEAD, POST, PUT, PATCH, DELETE", w.Header().Get(HeaderNameCORSAllowMethods))
+	assert.Equal(t, "Accept, Authorization, Content-Type, X-Requested-With",
+		w.Header().Get(HeaderNameCORSAllowHeaders))
+	assert.Equal(t, "false", w.Header().Get(HeaderNameCORSAllowCreds),
+		"Credentials should not be allowed.")
+}
+
+func TestStrictCORSPolicy(t *testing.T) {
+	c, err := StrictCORSPolicy("https://app.example.com")
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c.WriteHeaders(w, presetRequest("https://app.example.com"))
+	assert.Equal(t, "https://app.example.com", w.Header().Get(HeaderNameCORSAllowOrigin))
+	assert.Equal(t, "true", w.Header().Get(HeaderNameCORSAllowCreds),
+		"Credentials should be allowed.")
+	assert.Equal(t, "Origin", w.Header().Get(HeaderNameCORSVary),
+		"Responses should vary by origin.")
+	assert.Equal(t, "600", w.Header().Get(HeaderNameCORSMaxAge))
+
+	resp := httptest.NewRecorder()
+	c.Middleware()(http.NotFoundHandler()).ServeHTTP(resp, presetRequest("https://evil.example.com"))
+	assert.Equal(t, http.StatusForbidden, resp.Code, "Other origins should be rejected.")
+
+	_, err = StrictCORSPolicy()
+	assert.ErrorIs(t, err, ErrCORSInvalidOrigin, "Origins should be required.")
+	_, err = StrictCORSPolicy("*")
+	assert.ErrorIs(t, err, ErrCORSInvalidOrigin, "Wildcard origins should be rejected.")
+}
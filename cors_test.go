@@ -1,11 +1,16 @@
 package httpext
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/kenkeiter/httpext/middleware"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,6 +23,7 @@ func corsPolicyTest(t *testing.T) (*CORSPolicy, *http.Request, func() http.Respo
 	if err != nil {
 		t.Fatal(err)
 	}
+	req.Header.Set("Origin", "http://example.com")
 	f := func() http.ResponseWriter {
 		w := httptest.NewRecorder()
 		c.WriteHeaders(w, req)
@@ -38,6 +44,24 @@ func TestCORSWildcardOrigin(t *testing.T) {
 		"Vary header should be empty.")
 }
 
+func TestCORSNoOrigin(t *testing.T) {
+	c, req, apply := corsPolicyTest(t)
+	c.AllowAllOrigins()
+	c.AllowCredentials = true
+	c.MaxAge = time.Duration(time.Second * 60)
+	req.Header.Del("Origin")
+	resp := apply()
+	assert.Empty(t, resp.Header(),
+		"Requests without an Origin should not receive any CORS headers.")
+
+	c.AlwaysSendHeaders = true
+	resp = apply()
+	assert.Equal(t, "true", resp.Header().Get(HeaderNameCORSAllowCreds),
+		"AlwaysSendHeaders should force CORS headers without an Origin.")
+	assert.Equal(t, "null", resp.Header().Get(HeaderNameCORSAllowOrigin),
+		"AlwaysSendHeaders should force CORS headers without an Origin.")
+}
+
 func TestCORSExplicitOrigin(t *testing.T) {
 	c, req, apply := corsPolicyTest(t)
 	// set the origin, and then allow that origin
@@ -48,8 +72,8 @@ func TestCORSExplicitOrigin(t *testing.T) {
 	resp := apply()
 	assert.Equal(t, testOrigin, resp.Header().Get(HeaderNameCORSAllowOrigin),
 		"Access-Control-Allow-Origin should match accepted origin.")
-	assert.Empty(t, resp.Header().Get("Vary"),
-		"Vary header should be empty unless the server supports more than one origin.")
+	assert.Equal(t, "Origin", resp.Header().Get("Vary"),
+		"Vary header should be set whenever the origin is reflected.")
 
 	// Add an additional origin.
 	c.AllowOrigins("http://google.com")
@@ -64,6 +88,82 @@ func TestCORSExplicitOrigin(t *testing.T) {
 	resp = apply()
 	assert.Equal(t, "null", resp.Header().Get(HeaderNameCORSAllowOrigin),
 		"If server defines origins, and an unknown origin is provided, server should respond with null.")
+	assert.Equal(t, "Origin", resp.Header().Get("Vary"),
+		"Vary header should be set when the response depends on the origin.")
+}
+
+func TestCORSFixedOrigin(t *testing.T) {
+	c, req, apply := corsPolicyTest(t)
+	c.AllowFixedOrigin("https://app.example.com")
+	for _, origin := range []string{"https://app.example.com", "http://example.com", "http://kenkeiter.com"} {
+		req.Header.Set("Origin", origin)
+		resp := apply()
+		assert.Equal(t, "https://app.example.com", resp.Header().Get(HeaderNameCORSAllowOrigin),
+			"The fixed origin should be emitted for Origin %q.", origin)
+		assert.Empty(t, resp.Header().Get("Vary"), "Vary should be omitted for Origin %q.", origin)
+	}
+	assert.True(t, c.OriginAllowed("https://app.example.com"))
+	assert.False(t, c.OriginAllowed("http://example.com"))
+
+	// allowing further origins returns to reflection
+	c.AllowOrigins("http://example.com")
+	req.Header.Set("Origin", "http://example.com")
+	resp := apply()
+	assert.Equal(t, "http://example.com", resp.Header().Get(HeaderNameCORSAllowOrigin))
+	assert.Equal(t, "Origin", resp.Header().Get("Vary"))
+}
+
+func TestCORSAllowOriginPatterns(t *testing.T) {
+	c := &CORSPolicy{}
+	assert.NoError(t, c.AllowOriginPatterns("https://*.example.com", "http://*.dev.example.com:8080"))
+	for origin, allowed := range map[string]bool{
+		"https://app.example.com":               true,
+		"https://API.Example.com":               true,
+		"http://web.dev.example.com:8080":       true,
+		"https://example.com":                   false,
+		"https://.example.com":                  false,
+		"https://a.b.example.com":               false,
+		"https://example.com.evil.net":          false,
+		"https://app.example.com.evil.net":      false,
+		"https://evilexample.com":               false,
+		"https://app.example.com@evil.net":      false,
+		"https://evil.net/.example.com":         false,
+		"http://app.example.com":                false,
+		"https://app.example.com:8443":          false,
+		"http://web.dev.example.com":            false,
+		"http://web.dev.example.com:9090":       false,
+		"https://app.example.com.":              false,
+		"null":                                  false,
+		"https://*.example.com":                 false,
+		"https://app.example.com/path?q=.x.com": false,
+	} {
+		assert.Equal(t, allowed, c.OriginAllowed(origin), "OriginAllowed(%q)", origin)
+	}
+
+	for _, pattern := range []string{
+		"*", "https://*", "https://*.com", "https://*.com.", "https://app.*.com", "https://*.*.example.com",
+		"https://a*.example.com", "https://example.com", "*.example.com", "https://*.example.com/path",
+		"https://*.example.com:", "https://*.co.uk", "https://*.github.io",
+	} {
+		assert.ErrorIs(t, c.AllowOriginPatterns(pattern), ErrCORSInvalidOrigin,
+			"Pattern %q should be rejected.", pattern)
+	}
+	assert.Len(t, c.originPatterns, 2, "Invalid patterns should not be added.")
+	assert.False(t, c.OriginAllowed("https://evil.co.uk"))
+
+	uk := &CORSPolicy{}
+	assert.NoError(t, uk.AllowOriginPatterns("https://*.example.co.uk"),
+		"Patterns beneath a registrable domain should be accepted.")
+	assert.True(t, uk.OriginAllowed("https://app.example.co.uk"))
+	assert.False(t, uk.OriginAllowed("https://evil.co.uk"))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	c.WriteHeaders(w, req)
+	assert.Equal(t, "https://app.example.com", w.Header().Get(HeaderNameCORSAllowOrigin),
+		"Origins matching a pattern should be reflected.")
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
 }
 
 func TestCORSExposeHeaders(t *testing.T) {
@@ -76,8 +176,24 @@ func TestCORSExposeHeaders(t *testing.T) {
 		"Exposed headers should be listed in Access-Control-Expose-Headers header.")
 }
 
-func TestCORSMaxAge(t *testing.T) {
+func TestCORSExposeAllHeaders(t *testing.T) {
 	c, _, apply := corsPolicyTest(t)
+	c.ExposeAllHeaders()
+	assert.Equal(t, "*", apply().Header().Get(HeaderNameCORSExposeHeaders),
+		"All headers should be exposed by wildcard.")
+
+	c.ExposeHeaders("Authorization")
+	assert.Equal(t, "*, Authorization", apply().Header().Get(HeaderNameCORSExposeHeaders),
+		"Explicitly exposed headers should follow the wildcard.")
+
+	c.AllowCredentials = true
+	assert.Equal(t, "Authorization", apply().Header().Get(HeaderNameCORSExposeHeaders),
+		"The wildcard should be omitted for credentialed requests.")
+}
+
+func TestCORSMaxAge(t *testing.T) {
+	c, req, apply := corsPolicyTest(t)
+	req.Header.Set("Access-Control-Request-Method", "PUT")
 	c.MaxAge = time.Duration(time.Second * 60)
 	resp := apply()
 
@@ -99,8 +215,123 @@ func TestCORSAllowCreds(t *testing.T) {
 		"Access-Control-Allow-Credentials header should set to false when disabled.")
 }
 
+func TestCORSAllowCredentialsForMethods(t *testing.T) {
+	c := &CORSPolicy{}
+	c.AllowOrigins("http://example.com")
+	c.AllowMethods("GET", "DELETE")
+	c.AllowCredentialsForMethods("GET", "HEAD")
+	serve := func(method, requestMethod string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set("Origin", "http://example.com")
+		if requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", requestMethod)
+		}
+		w := httptest.NewRecorder()
+		c.WriteHeaders(w, req)
+		return w
+	}
+
+	assert.Equal(t, "true", serve("GET", "").Header().Get(HeaderNameCORSAllowCreds),
+		"Credentials should be allowed for GET.")
+	assert.Equal(t, "false", serve("DELETE", "").Header().Get(HeaderNameCORSAllowCreds),
+		"Credentials should not be allowed for DELETE.")
+
+	w := serve("OPTIONS", "GET")
+	assert.Equal(t, "true", w.Header().Get(HeaderNameCORSAllowCreds),
+		"Preflights should allow credentials for the requested method.")
+	assert.Equal(t, "Origin, Access-Control-Request-Method", w.Header().Get(HeaderNameCORSVary),
+		"Preflights should vary on the requested method.")
+	assert.Equal(t, "false", serve("OPTIONS", "DELETE").Header().Get(HeaderNameCORSAllowCreds))
+
+	c.AllowCredentials = true
+	assert.Equal(t, "true", serve("DELETE", "").Header().Get(HeaderNameCORSAllowCreds),
+		"AllowCredentials should allow credentials for every method.")
+}
+
+func TestCORSReflectRequestHeaders(t *testing.T) {
+	c, req, apply := corsPolicyTest(t)
+	c.AllowOrigins("http://example.com")
+	c.AllowHeaders("X-Test-Header")
+	c.AllowCredentials = true
+	c.ReflectRequestHeaders = true
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "x-custom, content-type")
+
+	resp := apply()
+	assert.Equal(t, "x-custom, content-type", resp.Header().Get(HeaderNameCORSAllowHeaders),
+		"Requested headers should be reflected verbatim.")
+	assert.Equal(t, "Origin, Access-Control-Request-Headers", resp.Header().Get(HeaderNameCORSVary))
+
+	req.Header.Del("Access-Control-Request-Headers")
+	resp = apply()
+	assert.Empty(t, resp.Header().Get(HeaderNameCORSAllowHeaders),
+		"No headers should be allowed if none are requested.")
+
+	c.ReflectRequestHeaders = false
+	resp = apply()
+	assert.Equal(t, "X-Test-Header", resp.Header().Get(HeaderNameCORSAllowHeaders),
+		"The configured headers should be listed by default.")
+	assert.Equal(t, "Origin", resp.Header().Get(HeaderNameCORSVary))
+}
+
+func TestCORSVaryMerge(t *testing.T) {
+	c, req, _ := corsPolicyTest(t)
+	c.AllowOrigins("http://example.com")
+	c.AllowAllHeaders()
+	c.AllowCredentials = true
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "X-Custom")
+
+	w := httptest.NewRecorder()
+	w.Header().Set(HeaderNameCORSVary, "Accept-Encoding")
+	c.WriteHeaders(w, req)
+	assert.Equal(t, "Accept-Encoding, Origin, Access-Control-Request-Headers",
+		w.Header().Get(HeaderNameCORSVary),
+		"Vary should list the origin and reflected headers alongside existing values.")
+	assert.Equal(t, "X-Custom", w.Header().Get(HeaderNameCORSAllowHeaders))
+
+	w = httptest.NewRecorder()
+	w.Header().Set(HeaderNameCORSVary, "origin")
+	c.WriteHeaders(w, req)
+	assert.Equal(t, "origin, Access-Control-Request-Headers", w.Header().Get(HeaderNameCORSVary),
+		"Vary values should not be duplicated.")
+
+	w = httptest.NewRecorder()
+	w.Header().Set(HeaderNameCORSVary, "*")
+	c.WriteHeaders(w, req)
+	assert.Equal(t, "*", w.Header().Get(HeaderNameCORSVary))
+}
+
+func TestCORSDeferCredentials(t *testing.T) {
+	c, req, _ := corsPolicyTest(t)
+	c.AllowAllOrigins()
+	c.AllowCredentials = false
+	apply := func() http.ResponseWriter {
+		w := httptest.NewRecorder()
+		w.Header().Set(HeaderNameCORSAllowCreds, "true")
+		c.WriteHeaders(w, req)
+		return w
+	}
+
+	resp := apply()
+	assert.Equal(t, "false", resp.Header().Get(HeaderNameCORSAllowCreds),
+		"Upstream Access-Control-Allow-Credentials should be overwritten by default.")
+
+	c.DeferCredentials = true
+	resp = apply()
+	assert.Equal(t, "true", resp.Header().Get(HeaderNameCORSAllowCreds),
+		"Upstream Access-Control-Allow-Credentials should be left alone when deferring.")
+
+	c, _, apply = corsPolicyTest(t)
+	c.DeferCredentials = true
+	resp = apply()
+	assert.Equal(t, "false", resp.Header().Get(HeaderNameCORSAllowCreds),
+		"Access-Control-Allow-Credentials should be written when not set upstream.")
+}
+
 func TestCORSAllowMethods(t *testing.T) {
-	c, _, apply := corsPolicyTest(t)
+	c, req, apply := corsPolicyTest(t)
+	req.Header.Set("Access-Control-Request-Method", "POST")
 
 	c.AllowAllMethods()
 	resp := apply()
@@ -114,8 +345,44 @@ func TestCORSAllowMethods(t *testing.T) {
 			"limited set of methods are allowed.")
 }
 
+func TestCORSPreflightRequestMethod(t *testing.T) {
+	c, req, apply := corsPolicyTest(t)
+	c.AllowOrigins("http://example.com")
+	c.AllowMethods("PUT", "PATCH")
+
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	resp := apply()
+	assert.Equal(t, "http://example.com", resp.Header().Get(HeaderNameCORSAllowOrigin),
+		"Preflights for allowed methods should receive CORS headers.")
+	assert.Equal(t, "PUT, PATCH", resp.Header().Get(HeaderNameCORSAllowMethods))
+
+	for _, method := range []string{"DELETE", "put"} {
+		req.Header.Set("Access-Control-Request-Method", method)
+		assert.Empty(t, apply().Header(), "Preflights for %q should receive no CORS headers.", method)
+		assert.False(t, c.MethodAllowed(method), "%q should not be allowed.", method)
+	}
+
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	assert.Equal(t, "http://example.com", apply().Header().Get(HeaderNameCORSAllowOrigin),
+		"Safelisted methods should always be allowed.")
+
+	c.AllowAllMethods()
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	resp = apply()
+	assert.Equal(t, "http://example.com", resp.Header().Get(HeaderNameCORSAllowOrigin),
+		"Any method should be allowed by the wildcard.")
+	assert.Equal(t, "*", resp.Header().Get(HeaderNameCORSAllowMethods))
+
+	// actual requests aren't checked, since the browser has already done so
+	c.AllowMethods("PUT")
+	req.Method = "DELETE"
+	req.Header.Del("Access-Control-Request-Method")
+	assert.Equal(t, "http://example.com", apply().Header().Get(HeaderNameCORSAllowOrigin))
+}
+
 func TestCORSAllowHeaders(t *testing.T) {
-	c, _, apply := corsPolicyTest(t)
+	c, req, apply := corsPolicyTest(t)
+	req.Header.Set("Access-Control-Request-Method", "PUT")
 
 	c.AllowAllHeaders()
 	resp := apply()
@@ -129,3 +396,565 @@ func TestCORSAllowHeaders(t *testing.T) {
 		"Access-Control-Allow-Headers header should contain list of headers when "+
 			"a specific subset is allowed.")
 }
+
+func TestCORSPreflightAndActualHeaders(t *testing.T) {
+	c, req, _ := corsPolicyTest(t)
+	c.AllowOrigins("http://example.com")
+	c.AllowMethods("GET", "PUT")
+	c.AllowHeaders("X-Test-Header")
+	c.ExposeHeaders("X-Exposed-Header")
+	c.MaxAge = time.Minute
+	c.AllowCredentials = true
+	preflightOnly := []string{HeaderNameCORSAllowMethods, HeaderNameCORSAllowHeaders, HeaderNameCORSMaxAge}
+
+	req.Method = "GET"
+	w := httptest.NewRecorder()
+	c.WriteHeaders(w, req)
+	assert.Equal(t, "http://example.com", w.Header().Get(HeaderNameCORSAllowOrigin))
+	assert.Equal(t, "true", w.Header().Get(HeaderNameCORSAllowCreds))
+	assert.Equal(t, "X-Exposed-Header", w.Header().Get(HeaderNameCORSExposeHeaders))
+	for _, name := range preflightOnly {
+		assert.Empty(t, w.Header().Get(name), "%s should not be sent with actual responses.", name)
+	}
+
+	req.Method = "OPTIONS"
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	w = httptest.NewRecorder()
+	c.WriteHeaders(w, req)
+	assert.Equal(t, "http://example.com", w.Header().Get(HeaderNameCORSAllowOrigin))
+	assert.Equal(t, "true", w.Header().Get(HeaderNameCORSAllowCreds))
+	assert.Equal(t, "GET, PUT", w.Header().Get(HeaderNameCORSAllowMethods))
+	assert.Equal(t, "X-Test-Header", w.Header().Get(HeaderNameCORSAllowHeaders))
+	assert.Equal(t, "60", w.Header().Get(HeaderNameCORSMaxAge))
+	assert.Empty(t, w.Header().Get(HeaderNameCORSExposeHeaders),
+		"Access-Control-Expose-Headers should not be sent with preflight responses.")
+
+	// either set may be written explicitly, whatever the request
+	w = httptest.NewRecorder()
+	c.WriteActualHeaders(w, req)
+	assert.Equal(t, "X-Exposed-Header", w.Header().Get(HeaderNameCORSExposeHeaders))
+	assert.Empty(t, w.Header().Get(HeaderNameCORSAllowMethods))
+
+	req.Method = "GET"
+	req.Header.Del("Access-Control-Request-Method")
+	w = httptest.NewRecorder()
+	c.WritePreflightHeaders(w, req)
+	assert.Equal(t, "GET, PUT", w.Header().Get(HeaderNameCORSAllowMethods))
+	assert.Empty(t, w.Header().Get(HeaderNameCORSExposeHeaders))
+}
+
+// corsMiddlewareTest serves req through the policy's middleware, returning
+// the response and whether the wrapped handler was invoked.
+func corsMiddlewareTest(c *CORSPolicy, req *http.Request) (*httptest.ResponseRecorder, bool) {
+	called := false
+	h := c.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w, called
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	c, req, _ := corsPolicyTest(t)
+	c.AllowAllOrigins()
+
+	req.Method = "GET"
+	resp, called := corsMiddlewareTest(c, req)
+	assert.True(t, called, "Actual requests should be passed through.")
+	assert.Equal(t, "*", resp.Header().Get(HeaderNameCORSAllowOrigin),
+		"Actual requests should receive CORS headers.")
+
+	req.Method = "OPTIONS"
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	resp, called = corsMiddlewareTest(c, req)
+	assert.False(t, called, "Preflight requests should not be passed through.")
+	assert.Equal(t, http.StatusNoContent, resp.Code, "Preflight requests should be answered with 204.")
+	assert.Equal(t, "*", resp.Header().Get(HeaderNameCORSAllowOrigin),
+		"Preflight requests should receive CORS headers.")
+}
+
+func TestCORSMiddlewareSet(t *testing.T) {
+	c := &CORSPolicy{}
+	c.AllowOrigins("http://example.com")
+	c.AllowMethods("GET", "PUT")
+
+	var reached []string
+	ms := &middleware.Set{}
+	ms.Use(c.Middleware())
+	ms.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			reached = append(reached, "middleware")
+			next.ServeHTTP(w, req)
+		})
+	})
+	h := ms.ApplyFunc(func(w http.ResponseWriter, req *http.Request) {
+		reached = append(reached, "handler")
+	})
+
+	for _, tt := range []struct {
+		method, requestMethod string
+		status                int
+		reached               []string
+	}{
+		{"GET", "", http.StatusOK, []string{"middleware", "handler"}},
+		{"OPTIONS", "", http.StatusOK, []string{"middleware", "handler"}},
+		{"OPTIONS", "PUT", http.StatusNoContent, nil},
+	} {
+		reached = nil
+		req := httptest.NewRequest(tt.method, "/", nil)
+		req.Header.Set("Origin", "http://example.com")
+		if tt.requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		assert.Equal(t, tt.status, w.Code, "%s (%q) status", tt.method, tt.requestMethod)
+		assert.Equal(t, tt.reached, reached, "%s (%q) should reach the rest of the chain unless a preflight.",
+			tt.method, tt.requestMethod)
+		assert.Equal(t, "http://example.com", w.Header().Get(HeaderNameCORSAllowOrigin))
+	}
+}
+
+func TestCORSPreflightContinue(t *testing.T) {
+	c, req, _ := corsPolicyTest(t)
+	c.AllowAllOrigins()
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+
+	continued := false
+	c.PreflightContinue = func(w http.ResponseWriter, r *http.Request) bool {
+		continued = true
+		return true
+	}
+	resp, called := corsMiddlewareTest(c, req)
+	assert.True(t, continued, "PreflightContinue should be called for preflights.")
+	assert.False(t, called, "Preflight requests should not be passed through.")
+	assert.Equal(t, http.StatusNoContent, resp.Code,
+		"Preflight should be answered when PreflightContinue returns true.")
+
+	c.PreflightContinue = func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	resp, called = corsMiddlewareTest(c, req)
+	assert.False(t, called, "Preflight requests should not be passed through.")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code,
+		"PreflightContinue should be able to halt the preflight with its own response.")
+	assert.Equal(t, "*", resp.Header().Get(HeaderNameCORSAllowOrigin),
+		"CORS headers should be written before PreflightContinue is called.")
+}
+
+func TestCORSStrictReject(t *testing.T) {
+	c, req, _ := corsPolicyTest(t)
+	c.AllowOrigins("http://example.com")
+	c.StrictReject = true
+	req.Method = "GET"
+
+	_, called := corsMiddlewareTest(c, req)
+	assert.True(t, called, "Requests from allowed origins should be passed through.")
+
+	req.Header.Set("Origin", "http://evil.com")
+	resp, called := corsMiddlewareTest(c, req)
+	assert.False(t, called, "Requests from disallowed origins should be rejected.")
+	assert.Equal(t, http.StatusForbidden, resp.Code, "Rejected requests should receive a 403.")
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header().Get("Content-Type"),
+		"Rejections should be rendered as JSON errors.")
+	assert.JSONEq(t, `{"id":"cors_origin_denied","i18n_key":"error.cors_origin_denied","message":"Requests from this origin are not allowed."}`,
+		resp.Body.String(), "Rejections should be rendered as JSON errors.")
+
+	req.Header.Set("Accept", "text/plain")
+	resp, _ = corsMiddlewareTest(c, req)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header().Get("Content-Type"),
+		"Rejections should be rendered in the media type negotiated with the client.")
+	assert.Equal(t, "Requests from this origin are not allowed.\n", resp.Body.String())
+
+	req.Header.Set("Accept", "image/png")
+	resp, _ = corsMiddlewareTest(c, req)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header().Get("Content-Type"),
+		"Rejections should fall back to JSON.")
+
+	req.Header.Del("Origin")
+	_, called = corsMiddlewareTest(c, req)
+	assert.True(t, called, "Requests without an Origin should be passed through.")
+}
+
+func TestCORSAllowOriginFunc(t *testing.T) {
+	tenant := regexp.MustCompile(`^https://[a-z0-9-]+\.tenants\.example\.com$`)
+	c, req, apply := corsPolicyTest(t)
+	c.AllowOrigins("https://admin.example.com")
+	c.AllowOriginFunc(tenant.MatchString)
+	c.AllowCredentials = true
+
+	for origin, allowed := range map[string]bool{
+		"https://admin.example.com":             true,
+		"https://acme.tenants.example.com":      true,
+		"https://acme.tenants.example.com.evil": false,
+		"https://other.example.com":             false,
+	} {
+		assert.Equal(t, allowed, c.OriginAllowed(origin), "OriginAllowed(%q)", origin)
+	}
+
+	req.Header.Set("Origin", "https://acme.tenants.example.com")
+	resp := apply()
+	assert.Equal(t, "https://acme.tenants.example.com", resp.Header().Get(HeaderNameCORSAllowOrigin),
+		"Origins allowed by the function should be reflected.")
+	assert.Equal(t, "Origin", resp.Header().Get("Vary"))
+
+	req.Header.Set("Origin", "https://other.example.com")
+	resp = apply()
+	assert.Equal(t, "null", resp.Header().Get(HeaderNameCORSAllowOrigin),
+		"Origins refused by the function should not be allowed.")
+}
+
+func TestCORSAllowOriginFuncErr(t *testing.T) {
+	c, req, _ := corsPolicyTest(t)
+	c.AllowOrigins("http://static.example.com")
+	c.AllowOriginFuncErr(func(origin string, req *http.Request) (bool, error) {
+		switch req.Header.Get("X-Tenant") {
+		case "acme":
+			return origin == "http://example.com", nil
+		case "broken":
+			return false, errors.New("tenant lookup failed")
+		}
+		return false, nil
+	})
+	req.Method = "GET"
+
+	req.Header.Set("X-Tenant", "acme")
+	allowed, err := c.CheckOrigin(req)
+	assert.True(t, allowed, "Origins accepted by the function should be allowed.")
+	assert.NoError(t, err)
+	resp, called := corsMiddlewareTest(c, req)
+	assert.True(t, called)
+	assert.Equal(t, "http://example.com", resp.Header().Get(HeaderNameCORSAllowOrigin))
+
+	req.Header.Set("X-Tenant", "other")
+	allowed, err = c.CheckOrigin(req)
+	assert.False(t, allowed, "Origins rejected by the function should be denied.")
+	assert.NoError(t, err)
+	resp, called = corsMiddlewareTest(c, req)
+	assert.True(t, called)
+	assert.Equal(t, "null", resp.Header().Get(HeaderNameCORSAllowOrigin))
+
+	req.Header.Set("X-Tenant", "broken")
+	allowed, err = c.CheckOrigin(req)
+	assert.False(t, allowed)
+	assert.Error(t, err, "Errors from the function should be surfaced.")
+	resp, called = corsMiddlewareTest(c, req)
+	assert.False(t, called, "Requests whose origin cannot be checked should not be passed through.")
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.JSONEq(t, `{"id":"cors_origin_check_failed","i18n_key":"error.cors_origin_check_failed","message":"The origin of the request could not be verified."}`,
+		resp.Body.String())
+
+	req.Header.Set("Origin", "http://static.example.com")
+	allowed, err = c.CheckOrigin(req)
+	assert.True(t, allowed, "Configured origins should not consult the function.")
+	assert.NoError(t, err)
+}
+
+func TestCORSCredentialedWildcards(t *testing.T) {
+	c, req, apply := corsPolicyTest(t)
+	c.AllowAllOrigins()
+	c.AllowAllMethods()
+	c.AllowAllHeaders()
+	c.AllowCredentials = true
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "X-Test-Header, Content-Type")
+	resp := apply()
+
+	assert.Equal(t, "true", resp.Header().Get(HeaderNameCORSAllowCreds),
+		"Credentials should be allowed.")
+	assert.Equal(t, "http://example.com", resp.Header().Get(HeaderNameCORSAllowOrigin),
+		"The request origin should be reflected in place of a wildcard.")
+	assert.Equal(t, "PUT", resp.Header().Get(HeaderNameCORSAllowMethods),
+		"The requested method should be reflected in place of a wildcard.")
+	assert.Equal(t, "X-Test-Header, Content-Type", resp.Header().Get(HeaderNameCORSAllowHeaders),
+		"The requested headers should be reflected in place of a wildcard.")
+	assert.Equal(t, "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+		resp.Header().Get(HeaderNameCORSVary), "Response should vary on all reflected headers.")
+	for name, values := range resp.Header() {
+		for _, v := range values {
+			assert.NotContains(t, v, "*", "%s should not contain a wildcard.", name)
+		}
+	}
+
+	// explicitly configured values are left alone
+	c, req, apply = corsPolicyTest(t)
+	c.AllowOrigins("http://example.com")
+	c.AllowMethods("GET", "POST")
+	c.AllowHeaders("X-Test-Header")
+	c.AllowCredentials = true
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	resp = apply()
+	assert.Equal(t, "GET, POST", resp.Header().Get(HeaderNameCORSAllowMethods),
+		"Configured methods should be listed.")
+	assert.Equal(t, "X-Test-Header", resp.Header().Get(HeaderNameCORSAllowHeaders),
+		"Configured headers should be listed.")
+	assert.Equal(t, "Origin", resp.Header().Get(HeaderNameCORSVary),
+		"Response should vary only on the origin.")
+}
+
+func TestCORSWildcardCredentialsNeverWildcard(t *testing.T) {
+	for _, deferred := range []bool{false, true} {
+		c := &CORSPolicy{}
+		c.AllowAllOrigins()
+		c.AllowAllMethods()
+		c.AllowAllHeaders()
+		c.ExposeAllHeaders()
+		c.AllowCredentials = !deferred
+		c.DeferCredentials = deferred
+
+		for _, preflight := range []bool{false, true} {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Origin", "http://example.com")
+			if preflight {
+				req.Method = "OPTIONS"
+				req.Header.Set("Access-Control-Request-Method", "PUT")
+			}
+			w := httptest.NewRecorder()
+			if deferred {
+				w.Header().Set(HeaderNameCORSAllowCreds, "true")
+			}
+			c.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, req)
+
+			assert.Equal(t, "true", w.Header().Get(HeaderNameCORSAllowCreds))
+			assert.Equal(t, "http://example.com", w.Header().Get(HeaderNameCORSAllowOrigin),
+				"The origin should be reflected (deferred %v, preflight %v).", deferred, preflight)
+			assert.Contains(t, w.Header().Get(HeaderNameCORSVary), "Origin")
+			for name, values := range w.Header() {
+				for _, v := range values {
+					assert.NotContains(t, v, "*", "%s should not contain a wildcard (deferred %v, preflight %v).",
+						name, deferred, preflight)
+				}
+			}
+		}
+	}
+}
+
+func TestCORSAllowSameOrigin(t *testing.T) {
+	c, req, apply := corsPolicyTest(t)
+	c.AllowOrigins("https://partner.example.com")
+	c.AllowSameOrigin("https://api.example.com")
+
+	req.Header.Set("Origin", "https://api.example.com")
+	assert.Equal(t, "https://api.example.com", apply().Header().Get(HeaderNameCORSAllowOrigin),
+		"The server's own origin should be allowed.")
+	req.Header.Set("Origin", "https://partner.example.com")
+	assert.Equal(t, "https://partner.example.com", apply().Header().Get(HeaderNameCORSAllowOrigin),
+		"Configured origins should still be allowed.")
+	req.Header.Set("Origin", "https://other.example.com")
+	assert.Equal(t, "null", apply().Header().Get(HeaderNameCORSAllowOrigin),
+		"Other origins should not be allowed.")
+
+	// derive the server's origin from the request
+	c.AllowSameOrigin("")
+	req.Host = "www.example.com"
+	req.Header.Set("Origin", "http://www.example.com")
+	assert.Equal(t, "http://www.example.com", apply().Header().Get(HeaderNameCORSAllowOrigin),
+		"Origins matching the request's host should be allowed.")
+	req.Header.Set("Origin", "https://www.example.com")
+	assert.Equal(t, "null", apply().Header().Get(HeaderNameCORSAllowOrigin),
+		"Origins with a different scheme should not be allowed.")
+}
+
+func TestCORSPostWrite(t *testing.T) {
+	c, req, apply := corsPolicyTest(t)
+	c.AllowOrigins("http://example.com")
+	var observed string
+	c.PostWrite = func(w http.ResponseWriter, req *http.Request) {
+		observed = w.Header().Get(HeaderNameCORSAllowOrigin)
+		w.Header().Set(HeaderNameCORSAllowOrigin, "http://rewritten.example.com")
+		w.Header().Set(HeaderNameCORSExposeHeaders, "X-Per-Request")
+	}
+
+	resp := apply()
+	assert.Equal(t, "http://example.com", observed, "The hook should observe the written headers.")
+	assert.Equal(t, "http://rewritten.example.com", resp.Header().Get(HeaderNameCORSAllowOrigin),
+		"The hook should be able to modify the written headers.")
+	assert.Equal(t, "X-Per-Request", resp.Header().Get(HeaderNameCORSExposeHeaders))
+
+	observed = ""
+	req.Header.Del("Origin")
+	apply()
+	assert.Equal(t, "", observed, "The hook should not run for requests without an Origin.")
+}
+
+func TestCORSMerge(t *testing.T) {
+	global := &CORSPolicy{MaxAge: time.Hour}
+	global.AllowOrigins("https://a.example.com", "https://b.example.com")
+	global.AllowMethods("GET")
+	route := &CORSPolicy{AllowCredentials: true}
+	route.AllowOrigins("https://b.example.com", "https://c.example.com")
+	route.AllowMethods("GET", "POST")
+
+	m := global.Merge(route)
+	for _, o := range []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"} {
+		assert.True(t, m.OriginAllowed(o), "Origin %q should be allowed by the merged policy.", o)
+	}
+	assert.False(t, m.OriginAllowed("https://d.example.com"))
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}, m.origins,
+		"Origins should not be duplicated.")
+	assert.Equal(t, []string{"GET", "POST"}, m.methods)
+	assert.True(t, m.AllowCredentials, "AllowCredentials should be overridden.")
+	assert.Equal(t, time.Hour, m.MaxAge, "MaxAge should be retained when unset by other.")
+	assert.False(t, global.AllowCredentials, "Merging should not modify the policies.")
+	assert.False(t, global.OriginAllowed("https://c.example.com"), "Merging should not modify the policies.")
+
+	wildcard := &CORSPolicy{MaxAge: time.Minute}
+	wildcard.AllowAllOrigins()
+	m = global.Merge(wildcard)
+	assert.True(t, m.OriginAllowed("https://d.example.com"), "Wildcards should take precedence.")
+	assert.Equal(t, time.Minute, m.MaxAge, "MaxAge should be overridden.")
+}
+
+func TestCORSClone(t *testing.T) {
+	base := &CORSPolicy{MaxAge: time.Hour}
+	base.AllowOrigins("https://a.example.com")
+	base.AllowMethods("GET")
+	base.AllowHeaders("X-Base")
+	base.ExposeHeaders("X-Count")
+	assert.NoError(t, base.AllowOriginPatterns("https://*.base.example.com"))
+
+	c := base.Clone()
+	c.AllowOrigins("https://b.example.com")
+	c.AllowMethods("POST")
+	c.AllowHeaders("X-Route")
+	c.ExposeHeaders("X-Route")
+	assert.NoError(t, c.AllowOriginPatterns("https://*.route.example.com"))
+	c.AllowCredentialsForMethods("POST")
+	c.MaxAge = time.Minute
+
+	assert.True(t, c.OriginAllowed("https://a.example.com"), "Clones should retain the original configuration.")
+	assert.True(t, c.OriginAllowed("https://b.example.com"))
+	assert.True(t, c.OriginAllowed("https://x.route.example.com"))
+	assert.Equal(t, []string{"GET", "POST"}, c.methods)
+
+	assert.False(t, base.OriginAllowed("https://b.example.com"), "Cloning should not share origins.")
+	assert.False(t, base.OriginAllowed("https://x.route.example.com"), "Cloning should not share patterns.")
+	assert.Equal(t, []string{"https://a.example.com"}, base.origins)
+	assert.Equal(t, []string{"GET"}, base.methods, "Cloning should not share methods.")
+	assert.Equal(t, []string{"X-Base"}, base.allowHeaders, "Cloning should not share headers.")
+	assert.Equal(t, []string{"X-Count"}, base.exposeHeaders, "Cloning should not share headers.")
+	assert.Len(t, base.credsMethods, 0)
+	assert.Equal(t, time.Hour, base.MaxAge)
+}
+
+func TestCORSWriteHeadersConcurrent(t *testing.T) {
+	c := &CORSPolicy{AllowCredentials: true, MaxAge: time.Hour}
+	c.AllowOrigins("https://a.example.com", "https://b.example.com")
+	c.AllowMethods("GET", "POST")
+	c.AllowAllHeaders()
+	c.ExposeHeaders("X-Count")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				req := httptest.NewRequest("OPTIONS", "/", nil)
+				origin := "https://a.example.com"
+				if (i+j)%2 == 0 {
+					origin = "https://c.example.com"
+				}
+				req.Header.Set("Origin", origin)
+				req.Header.Set("Access-Control-Request-Method", "POST")
+				req.Header.Set("Access-Control-Request-Headers", "X-Custom")
+				w := httptest.NewRecorder()
+				c.WriteHeaders(w, req)
+				if origin == "https://a.example.com" {
+					assert.Equal(t, origin, w.Header().Get(HeaderNameCORSAllowOrigin))
+				} else {
+					assert.Equal(t, "null", w.Header().Get(HeaderNameCORSAllowOrigin))
+				}
+				assert.Equal(t, "X-Custom", w.Header().Get(HeaderNameCORSAllowHeaders))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCORSValidate(t *testing.T) {
+	c := &CORSPolicy{}
+	c.AllowHeaders("X-Test-Header", "Content-Type")
+	c.ExposeHeaders("X-Total-Count")
+	assert.NoError(t, c.Validate(), "Valid header names should pass validation.")
+
+	c.AllowHeaders("X Bad Header")
+	assert.ErrorIs(t, c.Validate(), ErrCORSInvalidHeaderName,
+		"Header names containing spaces should be flagged.")
+
+	c = &CORSPolicy{}
+	c.ExposeHeaders("X-Count:")
+	assert.ErrorIs(t, c.Validate(), ErrCORSInvalidHeaderName,
+		"Exposed header names with illegal characters should be flagged.")
+
+	c = &CORSPolicy{}
+	c.AllowHeaders("")
+	assert.ErrorIs(t, c.Validate(), ErrCORSInvalidHeaderName,
+		"Empty header names should be flagged.")
+
+	c = &CORSPolicy{}
+	c.AllowOrigins("https://example.com", "http://localhost:3000", "null")
+	assert.NoError(t, c.Validate(), "Valid origins should pass validation.")
+}
+
+func TestCORSValidateMultiple(t *testing.T) {
+	c := &CORSPolicy{AllowCredentials: true}
+	c.AllowAllOrigins()
+	c.AllowHeaders("X Bad Header", "X-Good-Header")
+	c.ExposeHeaders("X-Count:")
+	err := c.Validate()
+	assert.ErrorIs(t, err, ErrCORSInvalidHeaderName)
+	assert.ErrorIs(t, err, ErrCORSWildcardCredentials)
+	assert.Contains(t, err.Error(), `"X Bad Header"`, "Every invalid header should be reported.")
+	assert.Contains(t, err.Error(), `"X-Count:"`, "Every invalid header should be reported.")
+	assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 3, "Each problem should be reported once.")
+
+	c = &CORSPolicy{StrictReject: true}
+	c.AllowOrigins()
+	assert.ErrorIs(t, c.Validate(), ErrCORSNoOrigins, "Rejecting every origin should be flagged.")
+	c.AllowOrigins("https://example.com/", "example.com")
+	err = c.Validate()
+	assert.ErrorIs(t, err, ErrCORSInvalidOrigin, "Malformed origins should be flagged.")
+	assert.False(t, errors.Is(err, ErrCORSNoOrigins), "Configured origins should satisfy StrictReject.")
+	assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 2)
+
+	c = &CORSPolicy{}
+	c.AllowAllOrigins()
+	c.AllowCredentialsForMethods("GET")
+	assert.ErrorIs(t, c.Validate(), ErrCORSWildcardCredentials)
+}
+
+// benchmarkOrigins returns a policy allowing n origins, along with the last
+// origin it allows.
+func benchmarkOrigins(n int) (*CORSPolicy, string) {
+	c := &CORSPolicy{}
+	for i := 0; i < n; i++ {
+		c.AllowOrigins(fmt.Sprintf("https://tenant%d.example.com", i))
+	}
+	return c, fmt.Sprintf("https://tenant%d.example.com", n-1)
+}
+
+func BenchmarkCORSOriginAllowed(b *testing.B) {
+	c, origin := benchmarkOrigins(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.OriginAllowed(origin)
+	}
+}
+
+// BenchmarkCORSOriginLinearScan measures the linear scan of configured
+// origins which OriginAllowed previously performed, for comparison.
+func BenchmarkCORSOriginLinearScan(b *testing.B) {
+	c, origin := benchmarkOrigins(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, o := range c.origins {
+			if o == origin {
+				break
+			}
+		}
+	}
+}
@@ -5,7 +5,12 @@ errors for HTTP APIs.
 package httperror
 
 import (
+	"encoding/json"
 	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 /*
@@ -27,10 +32,19 @@ type Error interface {
 	// occurred in one or two sentences.
 	Message() string
 
+	// I18nKey returns a stable key, derived from the ID, by which clients may
+	// look up a localized message for the error.
+	I18nKey() string
+
 	// Detail may optionally contain a marshallable interface{} providing
 	// additional contextual information about the error.
 	Detail() interface{}
 
+	// UnmarshalDetail decodes the detail into v, as encoding/json would, so
+	// that detail decoded generically -- by FromResponse, for example -- can
+	// be recovered as a typed value.
+	UnmarshalDetail(v interface{}) error
+
 	// Equal compares one Error with another, returning true if the errors are
 	// the same. Fields compared typically include ID, Status, and Message.
 	Equal(Error) bool
@@ -42,13 +56,46 @@ type Error interface {
 	// WithDetail clones the error, and creates a derivative instance that
 	// includes the detail interface{} provided.
 	WithDetail(interface{}) Error
+
+	// Timestamp returns the time at which the error occurred, or the zero time
+	// if it hasn't been set.
+	Timestamp() time.Time
+
+	// WithTimestamp clones the error, and creates a derivative instance that
+	// occurred at the time provided.
+	WithTimestamp(time.Time) Error
+
+	// IDPrefix clones the error, and creates a derivative instance whose ID
+	// is namespaced by the prefix provided.
+	IDPrefix(prefix string) Error
+
+	// WithStack clones the error, and creates a derivative instance that
+	// carries the stack of the goroutine calling WithStack, for logging.
+	WithStack() Error
+
+	// StackString formats the stack captured by WithStack, omitting frames
+	// from the runtime and testing packages, and from any of the package
+	// prefixes provided.
+	StackString(skipPackagePrefixes ...string) string
+
+	// DetailedString provides a key=value representation of the error,
+	// suitable for structured logging.
+	DetailedString() string
 }
 
+// IDSeparator separates the components of hierarchical error IDs, such as
+// "billing.invoice.not_found".
+const IDSeparator = "."
+
 type httpError struct {
 	status  int
 	id      string
 	message string
 	detail  interface{}
+	time    time.Time
+
+	location string
+	stack    []uintptr
 }
 
 // New creates a new type of error, given an HTTP status code, unique
@@ -61,6 +108,39 @@ func New(status int, id, message string) Error {
 	}
 }
 
+// MustNew creates a new error like New, but panics if the error is
+// mis-defined: if its id is empty, or its status is not a valid HTTP status
+// code (100-599). It is intended for initializing package-level errors, so
+// that mistakes are caught at program startup.
+func MustNew(status int, id, message string) Error {
+	if status < 100 || status > 599 {
+		panic(fmt.Sprintf("httperror: invalid status %d for error %q", status, id))
+	}
+	if id == "" {
+		panic(fmt.Sprintf("httperror: empty id for error %q", message))
+	}
+	return New(status, id, message)
+}
+
+// Newf creates a new error like New, formatting its message according to
+// format. The id is never formatted, so that the identity of the error remains
+// stable however its message varies.
+func Newf(status int, id, format string, args ...interface{}) Error {
+	return New(status, id, fmt.Sprintf(format, args...))
+}
+
+// Annotate wraps err with a message formatted according to format, such that
+// the result reads "message: err". The wrapped error remains available via
+// errors.As and errors.Is, so an Error can be recovered from the annotation.
+// If err is nil, Annotate returns nil, so that the result of a call which
+// succeeded may be annotated unconditionally.
+func Annotate(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), err)
+}
+
 // Error provides a string representation, and conforms the httperror
 // interface to Go's built-in error interface.
 func (e *httpError) Error() string {
@@ -70,11 +150,40 @@ func (e *httpError) Error() string {
 	return fmt.Sprintf("%s <HTTP %d:%s>", e.Message(), e.Status(), e.ID())
 }
 
+// DetailedString provides a logfmt-style representation of the error, such as
+// `id=err_not_found status=404 message="Not found." detail="user 42"`. The
+// detail key is omitted when the error has no detail.
+func (e *httpError) DetailedString() string {
+	s := fmt.Sprintf("id=%s status=%d message=%s", logfmtValue(e.ID()), e.Status(),
+		logfmtValue(e.Message()))
+	if e.Detail() != nil {
+		s += " detail=" + logfmtValue(fmt.Sprint(e.Detail()))
+	}
+	return s
+}
+
+// logfmtValue quotes s if it would otherwise be ambiguous as a logfmt value.
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =") || strconv.Quote(s) != `"`+s+`"` {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
 // ID returns a unique identifying string associated with the error.
 func (e *httpError) ID() string {
 	return e.id
 }
 
+// I18nKeyPrefix prefixes the ID of an error to form its I18nKey.
+const I18nKeyPrefix = "error" + IDSeparator
+
+// I18nKey returns the ID of the error prefixed by I18nKeyPrefix, such as
+// "error.not_found" or "error.billing.invoice.not_found".
+func (e *httpError) I18nKey() string {
+	return I18nKeyPrefix + e.id
+}
+
 // Status returns the HTTP status code associated with the error.
 func (e *httpError) Status() int {
 	return e.status
@@ -90,6 +199,24 @@ func (e *httpError) Detail() interface{} {
 	return e.detail
 }
 
+// UnmarshalDetail re-encodes the detail of the error as JSON, and decodes it
+// into v. If the error has no detail, v is left unmodified.
+func (e *httpError) UnmarshalDetail(v interface{}) error {
+	if e.detail == nil {
+		return nil
+	}
+	b, err := json.Marshal(e.detail)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Timestamp returns the time at which the error occurred, if set.
+func (e *httpError) Timestamp() time.Time {
+	return e.time
+}
+
 // Equal compares the status code and message of two Errors to determine if
 // they are identical. Equal does not compare detail, however; this is by
 // design to make error types more generalizable.
@@ -100,12 +227,21 @@ func (e *httpError) Equal(err Error) bool {
 }
 
 // Marshal provides an arbitrary representation of the details of the error.
+// The timestamp, if set, is represented in RFC 3339 format, and the I18nKey is
+// included as i18n_key, so that clients may display a localized message in
+// place of the server's own.
 func (e *httpError) Marshal() (interface{}, error) {
+	var timestamp string
+	if !e.time.IsZero() {
+		timestamp = e.time.Format(time.RFC3339)
+	}
 	repr := struct {
-		ID      string      `json:"id"`
-		Message string      `json:"message"`
-		Detail  interface{} `json:"detail,omitempty"`
-	}{e.ID(), e.Message(), e.Detail()}
+		ID        string      `json:"id"`
+		I18nKey   string      `json:"i18n_key"`
+		Message   string      `json:"message"`
+		Detail    interface{} `json:"detail,omitempty"`
+		Timestamp string      `json:"timestamp,omitempty"`
+	}{e.ID(), e.I18nKey(), e.Message(), e.Detail(), timestamp}
 	return repr, nil
 }
 
@@ -117,11 +253,92 @@ func (e *httpError) WithDetail(detail interface{}) Error {
 	return derivedErr
 }
 
+// WithTimestamp clones the Error and creates a new instance, setting the time
+// at which it occurred.
+func (e *httpError) WithTimestamp(t time.Time) Error {
+	derivedErr := e.clone()
+	derivedErr.time = t
+	return derivedErr
+}
+
+// IDPrefix clones the Error and creates a new instance, prepending prefix and
+// IDSeparator to its ID; prefixing "not_found" with "billing.invoice" produces
+// "billing.invoice.not_found".
+func (e *httpError) IDPrefix(prefix string) Error {
+	derivedErr := e.clone()
+	derivedErr.id = prefix + IDSeparator + e.id
+	return derivedErr
+}
+
+// WithStack clones the Error and creates a new instance carrying the stack of
+// the calling goroutine, beginning with the caller of WithStack.
+func (e *httpError) WithStack() Error {
+	derivedErr := e.clone()
+	pcs := make([]uintptr, 64)
+	derivedErr.stack = pcs[:runtime.Callers(2, pcs)]
+	return derivedErr
+}
+
+// stackSkipPrefixes are the prefixes of functions always omitted by
+// StackString, which are never of interest to an application.
+var stackSkipPrefixes = []string{"runtime.", "testing."}
+
+// StackString formats the stack captured by WithStack, in the manner of
+// runtime/debug.Stack, as a function name followed by an indented file and
+// line for each frame. Frames from the runtime and testing packages are
+// omitted, as are those whose function names begin with any of
+// skipPackagePrefixes, such as "net/http." or "github.com/kenkeiter/httpext/",
+// so that only application frames remain. StackString returns "" if no stack
+// was captured.
+func (e *httpError) StackString(skipPackagePrefixes ...string) string {
+	if len(e.stack) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		if !hasAnyPrefix(frame.Function, stackSkipPrefixes) &&
+			!hasAnyPrefix(frame.Function, skipPackagePrefixes) {
+			fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasIDPrefix reports whether the ID of e lies within the hierarchy named by
+// prefix: "billing.invoice.not_found" has the prefixes "billing" and
+// "billing.invoice", but not "bill". An ID is considered to have itself as a
+// prefix.
+func HasIDPrefix(e Error, prefix string) bool {
+	id := e.ID()
+	if !strings.HasPrefix(id, prefix) {
+		return false
+	}
+	return len(id) == len(prefix) || strings.HasPrefix(id[len(prefix):], IDSeparator)
+}
+
 func (e *httpError) clone() *httpError {
 	return &httpError{
 		id:      e.id,
 		status:  e.status,
 		message: e.message,
 		detail:  e.detail,
+		time:    e.time,
+
+		location: e.location,
+		stack:    e.stack,
 	}
 }
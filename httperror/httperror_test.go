@@ -1,8 +1,12 @@
 package httperror
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,6 +23,31 @@ func TestErrorCreation(t *testing.T) {
 		"Newly created error should not have detail when it was not specified.")
 }
 
+func TestErrorCreationMust(t *testing.T) {
+	assert.NotPanics(t, func() {
+		MustNew(http.StatusNotFound, "err_not_found", "Not found.")
+	}, "Valid errors should be created.")
+	assert.Panics(t, func() {
+		MustNew(4040, "err_not_found", "Not found.")
+	}, "Errors with invalid statuses should panic.")
+	assert.Panics(t, func() {
+		MustNew(99, "err_not_found", "Not found.")
+	}, "Errors with invalid statuses should panic.")
+	assert.Panics(t, func() {
+		MustNew(http.StatusNotFound, "", "Not found.")
+	}, "Errors without an id should panic.")
+}
+
+func TestErrorCreationFormatted(t *testing.T) {
+	e := Newf(http.StatusNotFound, "err_not_found", "User %d not found in %q.", 42, "accounts")
+
+	assert.Equal(t, http.StatusNotFound, e.Status(), "Error should make its status code accessible.")
+	assert.Equal(t, "err_not_found", e.ID(), "Unique error ID should not be formatted.")
+	assert.Equal(t, `User 42 not found in "accounts".`, e.Message(), "Message should be formatted.")
+	assert.True(t, e.Equal(Newf(http.StatusNotFound, "err_not_found", "User %d not found in %q.", 42, "accounts")),
+		"Identically formatted errors should be equal.")
+}
+
 func TestErrorDetail(t *testing.T) {
 	e := New(http.StatusNotFound, "err_missing_sanity", "Missing sanity.")
 	detailMsg := "Likely time of loss: when you started developing software."
@@ -29,6 +58,36 @@ func TestErrorDetail(t *testing.T) {
 	assert.Nil(t, e.Detail(), "Original error should not retain detail.")
 }
 
+func TestDetailedString(t *testing.T) {
+	e := New(http.StatusNotFound, "err_not_found", "Not found.")
+	assert.Equal(t, `id=err_not_found status=404 message="Not found."`, e.DetailedString(),
+		"Errors without detail should omit the detail key.")
+	assert.Equal(t, `id=err_not_found status=404 message="Not found." detail="user \"42\""`,
+		e.WithDetail(`user "42"`).DetailedString(), "Detail should be quoted when necessary.")
+	assert.Equal(t, `id=err_not_found status=404 message="Not found." detail=42`,
+		e.WithDetail(42).DetailedString(), "Simple values should not be quoted.")
+	assert.Equal(t, "Not found. <HTTP 404:err_not_found>", e.Error(),
+		"Error should remain unchanged.")
+}
+
+func TestAnnotate(t *testing.T) {
+	e := New(http.StatusNotFound, "err_no_user", "User not found.").WithDetail("user 42")
+	err := Annotate(e, "while loading %s", "profile")
+	assert.Equal(t, "while loading profile: User not found. (user 42) <HTTP 404:err_no_user>",
+		err.Error(), "Annotation should prefix the error.")
+
+	err = fmt.Errorf("handling request: %w", err)
+	var target Error
+	assert.True(t, errors.As(err, &target), "Error should be recoverable after annotation.")
+	assert.True(t, e.Equal(target), "Recovered error should match the original.")
+	assert.Equal(t, "user 42", target.Detail(), "Recovered error should retain its detail.")
+	assert.True(t, errors.Is(err, e), "Annotated error should match the original.")
+}
+
+func TestAnnotateNil(t *testing.T) {
+	assert.Nil(t, Annotate(nil, "loading user %d", 42), "Annotating nil should yield nil.")
+}
+
 func TestMarshalling(t *testing.T) {
 	e := New(http.StatusInternalServerError, "err_missing_server", "Missing server.")
 	repr, err := e.Marshal()
@@ -36,6 +95,42 @@ func TestMarshalling(t *testing.T) {
 	assert.NotNil(t, repr, "Marshalled representation should not be nil.")
 }
 
+func TestI18nKey(t *testing.T) {
+	for id, key := range map[string]string{
+		"not_found":                 "error.not_found",
+		"err_missing_server":        "error.err_missing_server",
+		"billing.invoice.not_found": "error.billing.invoice.not_found",
+	} {
+		e := New(http.StatusNotFound, id, "Not found.")
+		assert.Equal(t, key, e.I18nKey(), "I18nKey of %q", id)
+	}
+
+	e := New(http.StatusNotFound, "not_found", "Not found.").IDPrefix("billing")
+	assert.Equal(t, "error.billing.not_found", e.I18nKey(), "I18nKey should reflect prefixed IDs.")
+	repr, _ := e.Marshal()
+	b, _ := json.Marshal(repr)
+	assert.JSONEq(t, `{"id":"billing.not_found","i18n_key":"error.billing.not_found","message":"Not found."}`,
+		string(b), "Marshal should include the i18n_key.")
+}
+
+func TestStackString(t *testing.T) {
+	e := New(http.StatusInternalServerError, "internal_error", "An internal error occurred.")
+	assert.Empty(t, e.StackString(), "Errors without a captured stack should have none.")
+
+	stacked := e.WithStack()
+	stack := stacked.StackString()
+	assert.Contains(t, stack, "httperror.TestStackString\n\t", "Application frames should be kept.")
+	assert.Contains(t, stack, "httperror_test.go:", "Frames should include their file and line.")
+	assert.NotContains(t, stack, "testing.tRunner", "Frames from testing should be trimmed.")
+	assert.NotContains(t, stack, "runtime.", "Frames from the runtime should be trimmed.")
+	assert.NotContains(t, stack, "httperror.(*httpError).WithStack", "The stack should begin at the caller.")
+
+	assert.Empty(t, stacked.StackString("github.com/kenkeiter/httpext/httperror."),
+		"Frames from the given packages should be trimmed.")
+	assert.Equal(t, stack, stacked.WithDetail("x").StackString(), "Derived errors should keep the stack.")
+	assert.Empty(t, e.StackString(), "Capturing a stack should not modify the original.")
+}
+
 func ExampleError_detail() {
 	// globally, within your package
 	var (
@@ -44,7 +139,45 @@ func ExampleError_detail() {
 	)
 
 	// within a request handler function
-	if err := DoRiskyProcessing(); err != nil {
-		return ErrProcessingFailed.WithDetail(err)
+	doRiskyProcessing := func() error { return errors.New("out of coffee") }
+	if err := doRiskyProcessing(); err != nil {
+		fmt.Println(ErrProcessingFailed.WithDetail(err))
 	}
+	// Output: Processing of the specified person failed. (out of coffee) <HTTP 500:processing_fail>
+}
+
+func TestIDPrefix(t *testing.T) {
+	err := New(http.StatusNotFound, "not_found", "Invoice not found.")
+	prefixed := err.IDPrefix("billing").IDPrefix("acme")
+	assert.Equal(t, "acme.billing.not_found", prefixed.ID())
+	assert.Equal(t, "not_found", err.ID(), "The original error should not be modified.")
+	assert.Equal(t, err.Status(), prefixed.Status())
+	assert.Equal(t, err.Message(), prefixed.Message())
+}
+
+func TestHasIDPrefix(t *testing.T) {
+	err := New(http.StatusNotFound, "billing.invoice.not_found", "Invoice not found.")
+	assert.True(t, HasIDPrefix(err, "billing"))
+	assert.True(t, HasIDPrefix(err, "billing.invoice"))
+	assert.True(t, HasIDPrefix(err, "billing.invoice.not_found"))
+	assert.False(t, HasIDPrefix(err, "bill"), "Prefixes should match whole components.")
+	assert.False(t, HasIDPrefix(err, "invoice"))
+}
+
+func TestWithTimestamp(t *testing.T) {
+	err := New(http.StatusNotFound, "err_not_found", "Not found.")
+	assert.True(t, err.Timestamp().IsZero())
+	repr, _ := err.Marshal()
+	b, _ := json.Marshal(repr)
+	assert.JSONEq(t, `{"id":"err_not_found","i18n_key":"error.err_not_found","message":"Not found."}`, string(b),
+		"Errors without a timestamp should omit it.")
+
+	at := time.Date(2016, 5, 4, 12, 30, 0, 0, time.UTC)
+	stamped := err.WithTimestamp(at)
+	assert.Equal(t, at, stamped.Timestamp())
+	assert.True(t, err.Timestamp().IsZero(), "The original error should not be modified.")
+	repr, _ = stamped.Marshal()
+	b, _ = json.Marshal(repr)
+	assert.JSONEq(t, `{"id":"err_not_found","i18n_key":"error.err_not_found","message":"Not found.","timestamp":"2016-05-04T12:30:00Z"}`,
+		string(b), "The timestamp should be marshalled in RFC 3339 format.")
 }
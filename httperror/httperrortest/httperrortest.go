@@ -0,0 +1,66 @@
+/*
+Package httperrortest provides utilities for testing that HTTP responses carry
+the errors they are expected to.
+*/
+package httperrortest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/kenkeiter/httpext/httperror"
+)
+
+// envelope is the JSON representation of an httperror.Error. It may be
+// written bare, or wrapped within an "error" field.
+type envelope struct {
+	ID      string    `json:"id"`
+	Message string    `json:"message"`
+	Error   *envelope `json:"error"`
+}
+
+/*
+AssertError asserts that resp carries the error want, comparing the status
+code of the response and the id and message of the error in its body. The
+body may contain either a bare error representation, or one wrapped within an
+"error" field. The body of resp is restored so that it may be read again.
+
+AssertError reports whether the assertion succeeded.
+*/
+func AssertError(t testing.TB, resp *http.Response, want httperror.Error) bool {
+	t.Helper()
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		t.Errorf("reading response body: %v", err)
+		return false
+	}
+
+	var e envelope
+	if err := json.Unmarshal(body, &e); err != nil {
+		t.Errorf("response body %q is not an error: %v", body, err)
+		return false
+	}
+	if e.Error != nil {
+		e = *e.Error
+	}
+
+	ok := true
+	if resp.StatusCode != want.Status() {
+		t.Errorf("status = %d, want %d", resp.StatusCode, want.Status())
+		ok = false
+	}
+	if e.ID != want.ID() {
+		t.Errorf("id = %q, want %q", e.ID, want.ID())
+		ok = false
+	}
+	if e.Message != want.Message() {
+		t.Errorf("message = %q, want %q", e.Message, want.Message())
+		ok = false
+	}
+	return ok
+}
@@ -0,0 +1,77 @@
+package httperrortest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kenkeiter/httpext/httperror"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT captures failures reported by an assertion rather than failing
+// the test that's running it.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+var errNotFound = httperror.New(http.StatusNotFound, "err_not_found", "Not found.")
+
+func response(status int, body string) *http.Response {
+	w := httptest.NewRecorder()
+	w.WriteHeader(status)
+	w.WriteString(body)
+	return w.Result()
+}
+
+func TestAssertErrorBare(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&httperror.Responder{}).Write(w, errNotFound.WithDetail("user 42"))
+	rt := &recordingT{TB: t}
+
+	assert.True(t, AssertError(rt, w.Result(), errNotFound),
+		"A response carrying the error should pass.")
+	assert.Empty(t, rt.errors, "No failures should be reported.")
+}
+
+func TestAssertErrorWrapped(t *testing.T) {
+	resp := response(http.StatusNotFound, `{"error":{"id":"err_not_found","message":"Not found."}}`)
+	rt := &recordingT{TB: t}
+
+	assert.True(t, AssertError(rt, resp, errNotFound),
+		"A response carrying a wrapped error should pass.")
+	assert.Empty(t, rt.errors, "No failures should be reported.")
+}
+
+func TestAssertErrorMismatch(t *testing.T) {
+	resp := response(http.StatusGone, `{"id":"err_gone","message":"Gone."}`)
+	rt := &recordingT{TB: t}
+
+	assert.False(t, AssertError(rt, resp, errNotFound),
+		"A response carrying a different error should fail.")
+	assert.Len(t, rt.errors, 3, "Status, id and message mismatches should each be reported.")
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"id":"err_gone","message":"Gone."}`, string(body),
+		"The response body should be readable after the assertion.")
+}
+
+func TestAssertErrorNotJSON(t *testing.T) {
+	resp := response(http.StatusNotFound, "404 page not found")
+	rt := &recordingT{TB: t}
+
+	assert.False(t, AssertError(rt, resp, errNotFound),
+		"A response without an error body should fail.")
+	assert.True(t, len(rt.errors) == 1 && strings.Contains(rt.errors[0], "not an error"),
+		"The failure should describe the unparseable body.")
+}
@@ -0,0 +1,32 @@
+package httperror
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Redirect creates an Error which, written by a Responder, redirects the
+// client to location: the Location header is set, and the status written with
+// an empty body. Redirects aren't errors, but returning one lets handlers which
+// return Errors redirect through the same path as they fail. Redirect panics
+// unless status is one of 301, 302, 303, 307, or 308.
+func Redirect(status int, location string) Error {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		panic(fmt.Sprintf("httperror: invalid redirect status %d", status))
+	}
+	e := statusError(status).(*httpError)
+	e.location = location
+	return e
+}
+
+// Location returns the location to which e redirects, and whether it is a
+// redirect created by Redirect.
+func Location(e Error) (string, bool) {
+	if he, ok := e.(*httpError); ok && he.location != "" {
+		return he.location, true
+	}
+	return "", false
+}
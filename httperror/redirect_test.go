@@ -0,0 +1,34 @@
+package httperror
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirect(t *testing.T) {
+	for _, status := range []int{301, 302, 303, 307, 308} {
+		e := Redirect(status, "/login?next=%2Faccount")
+		w := httptest.NewRecorder()
+		assert.NoError(t, (&Responder{}).Write(w, e))
+		assert.Equal(t, status, w.Code, "Redirects should be written with their status.")
+		assert.Equal(t, "/login?next=%2Faccount", w.Header().Get("Location"),
+			"Redirects should set the Location header.")
+		assert.Empty(t, w.Body.String(), "Redirects should be written without a body.")
+	}
+
+	e := Redirect(http.StatusSeeOther, "https://example.com/")
+	assert.Equal(t, "see_other", e.ID())
+	location, ok := Location(e.WithDetail("ignored"))
+	assert.True(t, ok, "Derived errors should remain redirects.")
+	assert.Equal(t, "https://example.com/", location)
+
+	_, ok = Location(New(http.StatusNotFound, "not_found", "Not found."))
+	assert.False(t, ok, "Other errors aren't redirects.")
+
+	for _, status := range []int{200, 304, 404} {
+		assert.Panics(t, func() { Redirect(status, "/") }, "Status %d is not a redirect.", status)
+	}
+}
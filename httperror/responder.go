@@ -0,0 +1,163 @@
+package httperror
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	// MediaTypeJSON is the media type of errors written as JSON, as they are
+	// by default.
+	MediaTypeJSON = "application/json"
+
+	// MediaTypeText is the media type of errors written as plain text, which
+	// consists of their messages alone.
+	MediaTypeText = "text/plain"
+
+	// ContentType is the Content-Type of error responses written by a
+	// Responder as JSON.
+	ContentType = MediaTypeJSON + "; charset=utf-8"
+
+	// ContentTypeText is the Content-Type of error responses written by a
+	// Responder as plain text.
+	ContentTypeText = MediaTypeText + "; charset=utf-8"
+)
+
+// MediaTypes lists the media types in which a Responder can write Errors, the
+// default first, for content negotiation.
+var MediaTypes = []string{MediaTypeJSON, MediaTypeText}
+
+// ContentTypeFor returns the Content-Type of error responses written by a
+// Responder in mediaType, one of MediaTypes. Other media types are written
+// as JSON.
+func ContentTypeFor(mediaType string) string {
+	if mediaType == MediaTypeText {
+		return ContentTypeText
+	}
+	return ContentType
+}
+
+// RenderFunc produces the representation of an Error that is serialized into
+// the body of a response.
+type RenderFunc func(Error) (interface{}, error)
+
+// Renderer determines how Errors are represented when written by a Responder.
+type Renderer interface {
+	Render(Error) (interface{}, error)
+}
+
+/*
+ClassRenderer is a Renderer that dispatches to RenderFuncs registered either
+for a specific status code, or for a whole class of status codes (all 4xx, for
+example). A RenderFunc registered for a status code takes precedence over one
+registered for its class; Errors matching neither are rendered using their own
+Marshal method.
+*/
+type ClassRenderer struct {
+	classes  map[int]RenderFunc
+	statuses map[int]RenderFunc
+}
+
+// HandleClass registers f to render Errors within a class of status codes. The
+// class is the first digit of the status code; 5 matches all 5xx errors.
+func (c *ClassRenderer) HandleClass(class int, f RenderFunc) {
+	if c.classes == nil {
+		c.classes = make(map[int]RenderFunc)
+	}
+	c.classes[class] = f
+}
+
+// HandleStatus registers f to render Errors with the given status code.
+func (c *ClassRenderer) HandleStatus(status int, f RenderFunc) {
+	if c.statuses == nil {
+		c.statuses = make(map[int]RenderFunc)
+	}
+	c.statuses[status] = f
+}
+
+// Render produces a representation of e using the most specific RenderFunc
+// registered for its status code.
+func (c *ClassRenderer) Render(e Error) (interface{}, error) {
+	if f, ok := c.statuses[e.Status()]; ok {
+		return f(e)
+	}
+	if f, ok := c.classes[e.Status()/100]; ok {
+		return f(e)
+	}
+	return e.Marshal()
+}
+
+// Responder writes Errors to HTTP responses, as JSON unless another of
+// MediaTypes is negotiated (see WriteAs).
+type Responder struct {
+	// Renderer, if set, determines the representation of each Error written.
+	// Otherwise, the Error's Marshal method is used.
+	Renderer Renderer
+
+	// OmitServerErrorDetail strips the detail from any 5xx Error before it is
+	// rendered, so that internal information never reaches clients. The
+	// detail of 4xx Errors, which is typically relevant to clients, is kept.
+	OmitServerErrorDetail bool
+
+	// StampTime sets the timestamp of any Error without one to the time at
+	// which it is written.
+	StampTime bool
+
+	// Observe, if set, is called with the id and status code of each Error
+	// written, so that errors may be counted for monitoring. Since every
+	// Error passes through it, the Responder is the single point at which
+	// to observe them. Redirects, which aren't errors, aren't observed.
+	Observe func(id string, status int)
+}
+
+// Write renders e and writes it to w as JSON, along with its status code.
+// Redirects, created by Redirect, are written with a Location header and no
+// body.
+func (r *Responder) Write(w http.ResponseWriter, e Error) error {
+	return r.WriteAs(w, MediaTypeJSON, e)
+}
+
+// WriteAs is like Write, but writes e in mediaType, one of MediaTypes, as
+// negotiated with the client. Errors written as MediaTypeText consist of their
+// messages alone, and aren't passed to the Renderer. Other media types are
+// written as JSON.
+func (r *Responder) WriteAs(w http.ResponseWriter, mediaType string, e Error) error {
+	if location, ok := Location(e); ok {
+		w.Header().Set("Location", location)
+		w.WriteHeader(e.Status())
+		return nil
+	}
+	if r.Observe != nil {
+		r.Observe(e.ID(), e.Status())
+	}
+	if r.OmitServerErrorDetail && e.Status() >= 500 && e.Detail() != nil {
+		e = e.WithDetail(nil)
+	}
+	if r.StampTime && e.Timestamp().IsZero() {
+		e = e.WithTimestamp(time.Now())
+	}
+	var body []byte
+	if mediaType == MediaTypeText {
+		body = []byte(e.Message() + "\n")
+	} else {
+		repr, err := r.render(e)
+		if err != nil {
+			return err
+		}
+		if body, err = json.Marshal(repr); err != nil {
+			return err
+		}
+	}
+	w.Header().Set("Content-Type", ContentTypeFor(mediaType))
+	w.WriteHeader(e.Status())
+	_, err := w.Write(body)
+	return err
+}
+
+func (r *Responder) render(e Error) (interface{}, error) {
+	if r.Renderer != nil {
+		return r.Renderer.Render(e)
+	}
+	return e.Marshal()
+}
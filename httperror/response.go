@@ -0,0 +1,62 @@
+package httperror
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// envelope is the JSON representation of an Error, as produced by Marshal. It
+// may be written bare, or wrapped within an "error" field.
+type envelope struct {
+	ID        string      `json:"id"`
+	Message   string      `json:"message"`
+	Detail    interface{} `json:"detail"`
+	Timestamp time.Time   `json:"timestamp"`
+	Error     *envelope   `json:"error"`
+}
+
+// FromResponse reconstructs the Error carried by resp, for use by clients of an
+// API which writes its errors using this package. The body of resp is read in
+// full, but not closed; it may contain either a bare error representation, or
+// one wrapped within an "error" field. If the body doesn't contain an error --
+// because it isn't JSON, for example -- an Error is derived from the status
+// code of the response alone, such as one with the id "not_found" and message
+// "Not Found." for a 404. Detail is decoded as by encoding/json into an
+// interface{}.
+//
+// An error is returned only if the body cannot be read.
+func FromResponse(resp *http.Response) (Error, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var e envelope
+	if err := json.Unmarshal(body, &e); err == nil {
+		if e.Error != nil {
+			e = *e.Error
+		}
+		if e.ID != "" {
+			return &httpError{
+				status:  resp.StatusCode,
+				id:      e.ID,
+				message: e.Message,
+				detail:  e.Detail,
+				time:    e.Timestamp,
+			}, nil
+		}
+	}
+	return statusError(resp.StatusCode), nil
+}
+
+// statusError returns an Error describing status alone.
+func statusError(status int) Error {
+	text := http.StatusText(status)
+	if text == "" {
+		text = "Unknown Status"
+	}
+	id := strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+	return New(status, id, text+".")
+}
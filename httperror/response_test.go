@@ -0,0 +1,68 @@
+package httperror
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestFromResponse(t *testing.T) {
+	e, err := FromResponse(newResponse(http.StatusNotFound,
+		`{"id":"err_not_found","message":"Not found.","detail":{"user":"42"}}`))
+	assert.NoError(t, err)
+	assert.True(t, e.Equal(New(http.StatusNotFound, "err_not_found", "Not found.")),
+		"The error should be reconstructed from the body.")
+	assert.Equal(t, map[string]interface{}{"user": "42"}, e.Detail())
+
+	e, err = FromResponse(newResponse(http.StatusConflict,
+		`{"error":{"id":"err_conflict","message":"Conflict."}}`))
+	assert.NoError(t, err)
+	assert.True(t, e.Equal(New(http.StatusConflict, "err_conflict", "Conflict.")),
+		"Wrapped errors should be unwrapped.")
+	assert.Nil(t, e.Detail())
+}
+
+func TestFromResponseFallback(t *testing.T) {
+	e, err := FromResponse(newResponse(http.StatusBadGateway, "<html>Bad Gateway</html>"))
+	assert.NoError(t, err)
+	assert.True(t, e.Equal(New(http.StatusBadGateway, "bad_gateway", "Bad Gateway.")),
+		"Non-JSON bodies should produce an error derived from the status.")
+
+	e, err = FromResponse(newResponse(http.StatusTeapot, `{"ok":false}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "im_a_teapot", e.ID(), "JSON bodies without an error should fall back.")
+	assert.Equal(t, http.StatusTeapot, e.Status())
+}
+
+func TestUnmarshalDetail(t *testing.T) {
+	type detail struct {
+		Field  string `json:"field"`
+		Reason string `json:"reason"`
+		Limit  int    `json:"limit"`
+	}
+	want := detail{Field: "name", Reason: "too_long", Limit: 64}
+	e := New(http.StatusBadRequest, "err_invalid", "Invalid request.").WithDetail(want)
+	repr, _ := e.Marshal()
+	body, _ := json.Marshal(repr)
+
+	received, err := FromResponse(newResponse(http.StatusBadRequest, string(body)))
+	assert.NoError(t, err)
+	var got detail
+	assert.NoError(t, received.UnmarshalDetail(&got))
+	assert.Equal(t, want, got, "The detail should round-trip into a typed value.")
+
+	got = detail{}
+	assert.NoError(t, New(http.StatusNotFound, "err_not_found", "Not found.").UnmarshalDetail(&got))
+	assert.Equal(t, detail{}, got, "Errors without detail should leave v unmodified.")
+}
@@ -0,0 +1,45 @@
+package httperror
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Warning describes a non-fatal issue with an otherwise successful response,
+// such as the use of a deprecated field, or data which is only partially
+// available. Warnings may be sent in Warning headers using WriteWarnings, or
+// included in a response body.
+type Warning struct {
+	// Code is the warning code, as defined in section 5.5 of RFC 7234. The
+	// code 299 (Miscellaneous Persistent Warning) suits most applications.
+	Code int `json:"code"`
+
+	// Agent identifies the server adding the warning. If empty, "-" is used.
+	Agent string `json:"agent,omitempty"`
+
+	// Text describes the warning.
+	Text string `json:"text"`
+}
+
+// String formats the warning as the value of a Warning header, such as
+// `299 - "The field 'name' is deprecated."`.
+func (w Warning) String() string {
+	agent := w.Agent
+	if agent == "" {
+		agent = "-"
+	}
+	return fmt.Sprintf("%03d %s %s", w.Code, agent, quoteString(w.Text))
+}
+
+// WriteWarnings adds a Warning header to w for each of warnings.
+func WriteWarnings(w http.ResponseWriter, warnings ...Warning) {
+	for _, warning := range warnings {
+		w.Header().Add("Warning", warning.String())
+	}
+}
+
+// quoteString formats s as an HTTP quoted-string.
+func quoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,25 @@
+package httperror
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarningString(t *testing.T) {
+	assert.Equal(t, `299 - "The field 'name' is deprecated."`,
+		Warning{Code: 299, Text: "The field 'name' is deprecated."}.String())
+	assert.Equal(t, `199 api.example.com "Partial \"results\" only."`,
+		Warning{Code: 199, Agent: "api.example.com", Text: `Partial "results" only.`}.String(),
+		"Quotes in the text should be escaped.")
+}
+
+func TestWriteWarnings(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteWarnings(w,
+		Warning{Code: 299, Text: "Deprecated."},
+		Warning{Code: 199, Text: "Partial data."})
+	assert.Equal(t, []string{`299 - "Deprecated."`, `199 - "Partial data."`},
+		w.Header().Values("Warning"), "Each warning should be written in its own header.")
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// AutoHead returns middleware which answers HEAD requests using a handler
+// which implements only GET. The next handler is invoked with the request's
+// method set to GET, and a response writer which records its headers and
+// status but discards its body; once it returns, the headers are written
+// without a body. If the handler didn't set a Content-Length, it is set to the
+// length of the body the handler wrote -- zero, if it wrote none -- for any
+// status permitting a body, so that the response matches that of the
+// equivalent GET request. Other requests are passed through unchanged.
+func AutoHead() Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != "HEAD" {
+				next.ServeHTTP(w, req)
+				return
+			}
+			get := req.Clone(req.Context())
+			get.Method = "GET"
+			hw := &headResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(hw, get)
+			hw.finish()
+		})
+	}
+}
+
+// headResponseWriter is an http.ResponseWriter which defers writing the status
+// of a response until finish is called, and discards its body.
+type headResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *headResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.bytes += int64(len(b))
+	return len(b), nil
+}
+
+// Flush does nothing, since the body is discarded and the status is written
+// by finish.
+func (w *headResponseWriter) Flush() {}
+
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the recorded status, along with a Content-Length derived from
+// the discarded body if none was set.
+func (w *headResponseWriter) finish() {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	h := w.Header()
+	if h.Get("Content-Length") == "" && bodyAllowed(status) {
+		h.Set("Content-Length", strconv.FormatInt(w.bytes, 10))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// bodyAllowed reports whether a response with the given status may have a
+// body, and so a Content-Length.
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
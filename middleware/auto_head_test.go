@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoHead(t *testing.T) {
+	h := AutoHead()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("hello, world"))
+	}))
+
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest("GET", "/", nil))
+	head := httptest.NewRecorder()
+	h.ServeHTTP(head, httptest.NewRequest("HEAD", "/", nil))
+
+	assert.Equal(t, get.Code, head.Code, "HEAD should have the status of GET.")
+	assert.Equal(t, get.Header().Get("Content-Type"), head.Header().Get("Content-Type"))
+	assert.Equal(t, get.Header().Get("ETag"), head.Header().Get("ETag"))
+	assert.Equal(t, "12", head.Header().Get("Content-Length"),
+		"HEAD should report the length of the GET body.")
+	assert.Equal(t, 0, head.Body.Len(), "HEAD should have no body.")
+}
+
+func TestAutoHeadContentLength(t *testing.T) {
+	h := AutoHead()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// handlers may report the length without writing the body
+		w.Header().Set("Content-Length", "1024")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	head := httptest.NewRecorder()
+	h.ServeHTTP(head, httptest.NewRequest("HEAD", "/", nil))
+	assert.Equal(t, "1024", head.Header().Get("Content-Length"),
+		"Content-Length set by the handler should be preserved.")
+}
+
+func TestAutoHeadEmptyBody(t *testing.T) {
+	srv := httptest.NewServer(AutoHead()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/none" {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})))
+	defer srv.Close()
+
+	for _, path := range []string{"/", "/none"} {
+		get, err := http.Get(srv.URL + path)
+		assert.NoError(t, err)
+		get.Body.Close()
+		head, err := http.Head(srv.URL + path)
+		assert.NoError(t, err)
+		head.Body.Close()
+		assert.Equal(t, get.StatusCode, head.StatusCode)
+		assert.Equal(t, get.Header.Values("Content-Length"), head.Header.Values("Content-Length"),
+			"HEAD should report the Content-Length of GET for %s.", path)
+	}
+}
+
+func TestAutoHeadResponseController(t *testing.T) {
+	errs := make(chan error, 2)
+	srv := httptest.NewServer(AutoHead()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		errs <- rc.SetWriteDeadline(time.Now().Add(time.Minute))
+		w.Write([]byte("ok"))
+		errs <- rc.Flush()
+	})))
+	defer srv.Close()
+
+	for _, method := range []string{"GET", "HEAD"} {
+		req, _ := http.NewRequest(method, srv.URL, nil)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.NoError(t, <-errs, "%s handlers should be able to set write deadlines.", method)
+		assert.NoError(t, <-errs, "%s handlers should be able to flush.", method)
+	}
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kenkeiter/httpext/httperror"
+)
+
+// ErrCircuitOpen is written in response to requests short-circuited by a
+// CircuitBreaker.
+var ErrCircuitOpen = httperror.New(http.StatusServiceUnavailable, "circuit_open",
+	"The service is temporarily unavailable.")
+
+// BreakerOptions configures a CircuitBreaker.
+type BreakerOptions struct {
+	// FailureThreshold is the number of consecutive failed responses -- those
+	// with a 5xx status, or whose handlers panic -- after which the circuit
+	// trips open. Values less than 1 are treated as 1.
+	FailureThreshold int
+
+	// Cooldown is the time for which the circuit remains open before a
+	// single request is let through to test whether the handler has
+	// recovered.
+	Cooldown time.Duration
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is the state machine behind CircuitBreaker. Each change of state
+// begins a new generation, so that the outcomes of requests admitted in an
+// earlier state -- such as those still in flight when the circuit trips --
+// can be ignored.
+type breaker struct {
+	opts BreakerOptions
+	now  func() time.Time
+
+	mu         sync.Mutex
+	state      breakerState
+	generation uint64
+	failures   int
+	openedAt   time.Time
+}
+
+// admission records the state of the circuit in which a request was let
+// through.
+type admission struct {
+	generation uint64
+	trial      bool
+}
+
+func newBreaker(opts BreakerOptions, now func() time.Time) *breaker {
+	if opts.FailureThreshold < 1 {
+		opts.FailureThreshold = 1
+	}
+	return &breaker{opts: opts, now: now}
+}
+
+// CircuitBreaker returns middleware which protects a handler that depends on a
+// flaky downstream service. While the circuit is closed, requests are passed
+// through, and consecutive failures are counted; once they reach the failure
+// threshold, the circuit trips open, and requests are answered with
+// ErrCircuitOpen without invoking the handler. After the cooldown, the circuit
+// is half-open: a single request is let through, and the circuit closes if it
+// succeeds, or opens again if it fails. Other requests are short-circuited
+// until then. The outcomes of requests let through before the circuit last
+// changed state are ignored.
+func CircuitBreaker(opts BreakerOptions) Handler {
+	return newBreaker(opts, time.Now).middleware()
+}
+
+func (b *breaker) middleware() Handler {
+	responder := &httperror.Responder{}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			a, ok := b.allow()
+			if !ok {
+				responder.Write(w, ErrCircuitOpen)
+				return
+			}
+			rw := NewResponseWriter(w)
+			failed := true
+			defer func() {
+				b.record(a, failed)
+			}()
+			next.ServeHTTP(rw, req)
+			failed = rw.Status() >= 500
+		})
+	}
+}
+
+// allow reports whether a request may be passed through, and if so, the state
+// in which it was admitted, moving an open circuit to half-open once its
+// cooldown has elapsed.
+func (b *breaker) allow() (admission, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.opts.Cooldown {
+			return admission{}, false
+		}
+		b.transition(breakerHalfOpen)
+		return admission{generation: b.generation, trial: true}, true
+	case breakerHalfOpen:
+		// a trial request is already in flight
+		return admission{}, false
+	}
+	return admission{generation: b.generation}, true
+}
+
+// record updates the state of the circuit with the outcome of a request
+// admitted as a. Only a half-open circuit's trial closes or reopens it.
+func (b *breaker) record(a admission, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if a.generation != b.generation {
+		// the circuit has changed state since the request was admitted
+		return
+	}
+	switch {
+	case a.trial && failed:
+		b.trip()
+	case a.trial:
+		b.transition(breakerClosed)
+	case !failed:
+		b.failures = 0
+	default:
+		b.failures++
+		if b.failures >= b.opts.FailureThreshold {
+			b.trip()
+		}
+	}
+}
+
+// trip opens the circuit.
+func (b *breaker) trip() {
+	b.transition(breakerOpen)
+	b.openedAt = b.now()
+}
+
+// transition moves the circuit to state, beginning a new generation.
+func (b *breaker) transition(state breakerState) {
+	b.state = state
+	b.generation++
+	b.failures = 0
+}
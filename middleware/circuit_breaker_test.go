@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	status := http.StatusInternalServerError
+	calls := 0
+	h := newBreaker(BreakerOptions{
+		FailureThreshold: 3,
+		Cooldown:         time.Minute,
+	}, func() time.Time { return now }).middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	serve := func() int {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+		return resp.Code
+	}
+
+	// closed: failures are passed through until the threshold is reached
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusInternalServerError, serve(), "Closed circuits should pass requests through.")
+	}
+	assert.Equal(t, 3, calls)
+
+	// open: requests are short-circuited
+	assert.Equal(t, http.StatusServiceUnavailable, serve(), "Open circuits should short-circuit requests.")
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(), "Circuits should stay open until the cooldown.")
+	assert.Equal(t, 3, calls, "Short-circuited requests should not reach the handler.")
+
+	// half-open: a failed trial reopens the circuit
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusInternalServerError, serve(), "Half-open circuits should let a trial through.")
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(), "Failed trials should reopen the circuit.")
+
+	// half-open: a successful trial closes the circuit
+	now = now.Add(time.Minute)
+	status = http.StatusOK
+	assert.Equal(t, http.StatusOK, serve())
+	assert.Equal(t, http.StatusOK, serve(), "Successful trials should close the circuit.")
+	assert.Equal(t, 6, calls)
+
+	// closed: successes reset the count of consecutive failures
+	status = http.StatusInternalServerError
+	serve()
+	serve()
+	status = http.StatusOK
+	serve()
+	status = http.StatusInternalServerError
+	serve()
+	assert.Equal(t, http.StatusInternalServerError, serve(), "Only consecutive failures should trip the circuit.")
+}
+
+func TestCircuitBreakerHalfOpenSingleTrial(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(BreakerOptions{FailureThreshold: 1, Cooldown: time.Second},
+		func() time.Time { return now })
+	a, _ := b.allow()
+	b.record(a, true)
+	_, ok := b.allow()
+	assert.False(t, ok, "The circuit should be open.")
+	now = now.Add(time.Second)
+	trial, ok := b.allow()
+	assert.True(t, ok, "A trial should be allowed after the cooldown.")
+	assert.True(t, trial.trial)
+	_, ok = b.allow()
+	assert.False(t, ok, "Only one trial should be allowed at a time.")
+	b.record(trial, false)
+	_, ok = b.allow()
+	assert.True(t, ok, "The circuit should be closed.")
+}
+
+func TestCircuitBreakerLateResults(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(BreakerOptions{FailureThreshold: 1, Cooldown: time.Minute},
+		func() time.Time { return now })
+	slowSuccess, _ := b.allow()
+	slowFailure, _ := b.allow()
+	tripping, _ := b.allow()
+	b.record(tripping, true)
+
+	// requests admitted while the circuit was closed finish once it's open
+	now = now.Add(30 * time.Second)
+	b.record(slowSuccess, false)
+	_, ok := b.allow()
+	assert.False(t, ok, "Late successes should not close an open circuit.")
+	b.record(slowFailure, true)
+	now = now.Add(30 * time.Second)
+	trial, ok := b.allow()
+	assert.True(t, ok, "Late failures should not extend the cooldown.")
+
+	// the trial alone decides whether the circuit closes
+	b.record(slowSuccess, false)
+	_, ok = b.allow()
+	assert.False(t, ok, "Late successes should not close a half-open circuit.")
+	b.record(trial, true)
+	_, ok = b.allow()
+	assert.False(t, ok, "A failed trial should reopen the circuit.")
+}
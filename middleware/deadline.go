@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderNameGRPCTimeout is the header in which gRPC carries the timeout of
+	// a call, such as "250m".
+	HeaderNameGRPCTimeout = "Grpc-Timeout"
+
+	// HeaderNameRequestDeadline is a header carrying the absolute deadline of
+	// a request, such as "2024-05-01T12:00:00.5Z".
+	HeaderNameRequestDeadline = "X-Request-Deadline"
+)
+
+var errInvalidTimeout = errors.New("invalid timeout")
+
+// DeadlineFormat is the format of a header carrying a deadline.
+type DeadlineFormat int
+
+const (
+	// DeadlineGRPCTimeout is the format of gRPC's grpc-timeout header: a
+	// timeout of an integer of at most 8 digits followed by a unit of H, M, S,
+	// m, u, or n, as in "250m" (250 milliseconds).
+	DeadlineGRPCTimeout DeadlineFormat = iota
+
+	// DeadlineDuration is a timeout in the format of a Go duration, such as
+	// "1.5s" or "5m" (5 minutes).
+	DeadlineDuration
+
+	// DeadlineAbsolute is an absolute deadline, either in the format of RFC
+	// 3339, such as "2024-05-01T12:00:00.5Z", or in milliseconds since the
+	// Unix epoch, such as "1714564800500".
+	DeadlineAbsolute
+)
+
+// DeadlineFormatFor returns the format of the deadline carried by the header
+// headerName: DeadlineGRPCTimeout for HeaderNameGRPCTimeout,
+// DeadlineAbsolute for HeaderNameRequestDeadline, and DeadlineDuration for
+// any other header.
+func DeadlineFormatFor(headerName string) DeadlineFormat {
+	switch {
+	case strings.EqualFold(headerName, HeaderNameGRPCTimeout):
+		return DeadlineGRPCTimeout
+	case strings.EqualFold(headerName, HeaderNameRequestDeadline):
+		return DeadlineAbsolute
+	}
+	return DeadlineDuration
+}
+
+// PropagateDeadline returns middleware which applies the deadline carried by
+// the request header headerName to the request's context, so that work done on
+// behalf of an upstream caller stops once the caller has given up. The format
+// of the header is chosen by DeadlineFormatFor; use PropagateDeadlineFormat to
+// choose it explicitly. Requests without the header, or with a value not in
+// that format, are passed through unchanged.
+//
+// Use WriteDeadline to pass the remaining budget on to downstream services.
+func PropagateDeadline(headerName string) Handler {
+	return PropagateDeadlineFormat(headerName, DeadlineFormatFor(headerName))
+}
+
+// PropagateDeadlineFormat is like PropagateDeadline, but reads the header
+// headerName in the given format.
+func PropagateDeadlineFormat(headerName string, format DeadlineFormat) Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			deadline, err := parseDeadline(req.Header.Get(headerName), format, time.Now())
+			if err != nil {
+				next.ServeHTTP(w, req)
+				return
+			}
+			ctx, cancel := context.WithDeadline(req.Context(), deadline)
+			defer cancel()
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// WriteDeadline sets the header headerName of h to the deadline of ctx, in the
+// format chosen by DeadlineFormatFor, for use in requests to downstream
+// services. It reports whether ctx has a deadline. Timeouts are rounded up to
+// the millisecond, so that a nonzero budget is never reported as none; if the
+// deadline has already passed, a timeout of zero is written.
+func WriteDeadline(ctx context.Context, h http.Header, headerName string) bool {
+	return WriteDeadlineFormat(ctx, h, headerName, DeadlineFormatFor(headerName))
+}
+
+// WriteDeadlineFormat is like WriteDeadline, but writes the header headerName
+// in the given format. Absolute deadlines are written in the format of RFC
+// 3339, in UTC.
+func WriteDeadlineFormat(ctx context.Context, h http.Header, headerName string, format DeadlineFormat) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return false
+	}
+	switch format {
+	case DeadlineAbsolute:
+		h.Set(headerName, deadline.UTC().Format(time.RFC3339Nano))
+	case DeadlineDuration:
+		h.Set(headerName, roundTimeout(time.Until(deadline)).String())
+	default:
+		h.Set(headerName, formatTimeout(time.Until(deadline)))
+	}
+	return true
+}
+
+// parseDeadline parses s, a deadline in the given format, relative to now.
+func parseDeadline(s string, format DeadlineFormat, now time.Time) (time.Time, error) {
+	if format == DeadlineAbsolute {
+		return parseAbsoluteDeadline(s)
+	}
+	var timeout time.Duration
+	var err error
+	if format == DeadlineDuration {
+		timeout, err = parseDuration(s)
+	} else {
+		timeout, err = parseTimeout(s)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(timeout), nil
+}
+
+// timeoutUnits maps the units of a gRPC timeout to their durations.
+var timeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseTimeout parses a gRPC timeout.
+func parseTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, errInvalidTimeout
+	}
+	unit, ok := timeoutUnits[s[len(s)-1]]
+	if !ok || !isDigits(s[:len(s)-1]) {
+		return 0, errInvalidTimeout
+	}
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+	if err != nil {
+		return 0, errInvalidTimeout
+	}
+	if n > uint64(math.MaxInt64/unit) {
+		return math.MaxInt64, nil
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// parseDuration parses a non-negative Go duration.
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errInvalidTimeout
+	}
+	return d, nil
+}
+
+// parseAbsoluteDeadline parses an RFC 3339 time, or a number of milliseconds
+// since the Unix epoch.
+func parseAbsoluteDeadline(s string) (time.Time, error) {
+	if isDigits(s) {
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, errInvalidTimeout
+		}
+		return time.UnixMilli(ms), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, errInvalidTimeout
+	}
+	return t, nil
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// roundTimeout rounds d up to the millisecond, or to zero if it's negative.
+func roundTimeout(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return (d + time.Millisecond - 1) / time.Millisecond * time.Millisecond
+}
+
+// formatTimeout formats d as a gRPC timeout in milliseconds, rounded up so that
+// a nonzero budget is never reported as none.
+func formatTimeout(d time.Duration) string {
+	ms := roundTimeout(d) / time.Millisecond
+	if ms > 99999999 {
+		return strconv.FormatInt(int64(d/time.Second), 10) + "S"
+	}
+	return strconv.FormatInt(int64(ms), 10) + "m"
+}
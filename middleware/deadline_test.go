@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var parseDeadlineTests = []struct {
+	s        string
+	format   DeadlineFormat
+	deadline time.Duration // after now
+	ok       bool
+}{
+	{"250m", DeadlineGRPCTimeout, 250 * time.Millisecond, true},
+	{"2S", DeadlineGRPCTimeout, 2 * time.Second, true},
+	{"1H", DeadlineGRPCTimeout, time.Hour, true},
+	{"100u", DeadlineGRPCTimeout, 100 * time.Microsecond, true},
+	{"5m", DeadlineGRPCTimeout, 5 * time.Millisecond, true},
+	{"1.5s", DeadlineGRPCTimeout, 0, false},
+	{"90s", DeadlineGRPCTimeout, 0, false},
+	{"+5m", DeadlineGRPCTimeout, 0, false},
+	{"123456789m", DeadlineGRPCTimeout, 0, false},
+	{"1.5s", DeadlineDuration, 1500 * time.Millisecond, true},
+	{"5m", DeadlineDuration, 5 * time.Minute, true},
+	{"250", DeadlineDuration, 0, false},
+	{"-5s", DeadlineDuration, 0, false},
+	{"2024-05-01T12:00:10Z", DeadlineAbsolute, 10 * time.Second, true},
+	{"2024-05-01T14:00:00.5+02:00", DeadlineAbsolute, 500 * time.Millisecond, true},
+	{"1714564801500", DeadlineAbsolute, 1500 * time.Millisecond, true},
+	{"5s", DeadlineAbsolute, 0, false},
+	{"", DeadlineGRPCTimeout, 0, false},
+	{"", DeadlineDuration, 0, false},
+	{"", DeadlineAbsolute, 0, false},
+	{"soon", DeadlineDuration, 0, false},
+}
+
+func TestParseDeadline(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range parseDeadlineTests {
+		deadline, err := parseDeadline(tt.s, tt.format, now)
+		if !tt.ok {
+			assert.Error(t, err, "parseDeadline(%q, %d) should fail", tt.s, tt.format)
+			continue
+		}
+		assert.NoError(t, err, "parseDeadline(%q, %d) should not fail", tt.s, tt.format)
+		assert.Equal(t, tt.deadline, deadline.Sub(now), "parseDeadline(%q, %d)", tt.s, tt.format)
+	}
+}
+
+func TestDeadlineFormatFor(t *testing.T) {
+	assert.Equal(t, DeadlineGRPCTimeout, DeadlineFormatFor("grpc-timeout"))
+	assert.Equal(t, DeadlineAbsolute, DeadlineFormatFor("x-request-deadline"))
+	assert.Equal(t, DeadlineDuration, DeadlineFormatFor("X-Request-Timeout"))
+}
+
+func TestPropagateDeadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	h := PropagateDeadline("grpc-timeout")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("grpc-timeout", "500m")
+	start := time.Now()
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(t, ok, "The request context should have a deadline.")
+	assert.True(t, !deadline.Before(start.Add(500*time.Millisecond)) &&
+		deadline.Before(time.Now().Add(500*time.Millisecond+time.Millisecond)),
+		"The deadline should reflect the timeout.")
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.False(t, ok, "Requests without the header should have no deadline.")
+}
+
+func TestPropagateAbsoluteDeadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	h := PropagateDeadline(HeaderNameRequestDeadline)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	}))
+
+	want := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderNameRequestDeadline, want.Format(time.RFC3339Nano))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(t, ok, "The request context should have a deadline.")
+	assert.True(t, deadline.Equal(want), "The deadline should be applied as given in RFC 3339.")
+
+	req.Header.Set(HeaderNameRequestDeadline, strconv.FormatInt(want.UnixMilli(), 10))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(t, ok, "The request context should have a deadline.")
+	assert.True(t, deadline.Equal(want), "The deadline should be applied as given in Unix milliseconds.")
+
+	req.Header.Set(HeaderNameRequestDeadline, "500m")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.False(t, ok, "Timeouts should not be accepted in place of deadlines.")
+}
+
+func TestWriteDeadline(t *testing.T) {
+	h := http.Header{}
+	assert.False(t, WriteDeadline(context.Background(), h, "grpc-timeout"))
+	assert.Equal(t, "", h.Get("grpc-timeout"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.True(t, WriteDeadline(ctx, h, "grpc-timeout"))
+	timeout, err := parseTimeout(h.Get("grpc-timeout"))
+	assert.NoError(t, err)
+	assert.True(t, timeout > 900*time.Millisecond && timeout <= time.Second,
+		"The remaining budget should be written.")
+
+	assert.True(t, WriteDeadline(ctx, h, "X-Request-Timeout"))
+	timeout, err = parseDuration(h.Get("X-Request-Timeout"))
+	assert.NoError(t, err)
+	assert.True(t, timeout > 900*time.Millisecond && timeout <= time.Second,
+		"The remaining budget should be written as a Go duration.")
+
+	assert.True(t, WriteDeadline(ctx, h, HeaderNameRequestDeadline))
+	deadline, _ := ctx.Deadline()
+	written, err := parseAbsoluteDeadline(h.Get(HeaderNameRequestDeadline))
+	assert.NoError(t, err)
+	assert.True(t, written.Equal(deadline), "The deadline should be written as is.")
+}
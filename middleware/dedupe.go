@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DedupeHeaders returns middleware which collapses the values of each of the
+// named comma-separated list headers -- as may be added by several layers of
+// middleware -- into a single value listing each element once, in the order
+// in which they first appear. Elements are compared case-insensitively, and
+// commas within quoted strings don't separate elements. If no names are
+// given, Vary, Cache-Control, and Access-Control-Expose-Headers are
+// deduplicated.
+//
+// Headers are deduplicated just before the response header is written, so
+// values added after then, or by middleware wrapping DedupeHeaders once the
+// handler returns, are left as they are. Only identical elements are
+// collapsed; conflicting directives, such as "max-age=0" and "max-age=60",
+// are both retained.
+func DedupeHeaders(names ...string) Handler {
+	if len(names) == 0 {
+		names = []string{"Vary", "Cache-Control", "Access-Control-Expose-Headers"}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			rw := NewResponseWriter(w)
+			rw.beforeWriteHeader = func(int) {
+				dedupeHeaders(rw.Header(), names)
+			}
+			next.ServeHTTP(rw, req)
+			if rw.Status() == 0 {
+				// nothing has been written; the header will be written once
+				// the handler returns
+				dedupeHeaders(rw.Header(), names)
+			}
+		})
+	}
+}
+
+func dedupeHeaders(h http.Header, names []string) {
+	for _, name := range names {
+		values := h.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		var elems []string
+		seen := make(map[string]bool)
+		for _, line := range values {
+			for _, v := range splitList(line) {
+				if v == "" || seen[strings.ToLower(v)] {
+					continue
+				}
+				seen[strings.ToLower(v)] = true
+				elems = append(elems, v)
+			}
+		}
+		h.Set(name, strings.Join(elems, ", "))
+	}
+}
+
+// splitList splits a comma-separated header value into its trimmed elements,
+// ignoring commas within quoted strings.
+func splitList(s string) []string {
+	var elems []string
+	begin := 0
+	quote, escape := false, false
+	for i := 0; i < len(s); i++ {
+		switch b := s[i]; {
+		case escape:
+			escape = false
+		case quote:
+			switch b {
+			case '\\':
+				escape = true
+			case '"':
+				quote = false
+			}
+		case b == '"':
+			quote = true
+		case b == ',':
+			elems = append(elems, strings.TrimSpace(s[begin:i]))
+			begin = i + 1
+		}
+	}
+	return append(elems, strings.TrimSpace(s[begin:]))
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupeHeaders(t *testing.T) {
+	ms := &Set{}
+	ms.Use(DedupeHeaders())
+	ms.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Add("Vary", "Origin")
+			w.Header().Add("Cache-Control", "private")
+			next.ServeHTTP(w, req)
+		})
+	})
+	h := ms.ApplyFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding, origin")
+		w.Header().Add("Vary", "Origin, Accept")
+		w.Header().Add("Cache-Control", `private, no-cache="Set-Cookie, X-Token"`)
+		w.Header().Add("X-Other", "a")
+		w.Header().Add("X-Other", "a")
+		w.Write([]byte("ok"))
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, []string{"Origin, Accept-Encoding, Accept"}, w.Header().Values("Vary"),
+		"Duplicate Vary entries should be collapsed.")
+	assert.Equal(t, []string{`private, no-cache="Set-Cookie, X-Token"`}, w.Header().Values("Cache-Control"),
+		"Commas within quoted strings should not separate elements.")
+	assert.Equal(t, []string{"a", "a"}, w.Header().Values("X-Other"),
+		"Unlisted headers should be left as they are.")
+}
+
+func TestDedupeHeadersNamed(t *testing.T) {
+	h := DedupeHeaders("X-Tags")(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("X-Tags", "a, b")
+		w.Header().Add("X-Tags", "b, , c")
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Origin")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "a, b, c", w.Header().Get("X-Tags"),
+		"Headers should be deduplicated when the handler writes nothing.")
+	assert.Equal(t, []string{"Origin", "Origin"}, w.Header().Values("Vary"),
+		"Only the named headers should be deduplicated.")
+}
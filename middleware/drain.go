@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Drain tracks the number of requests in flight through its Middleware, so
+// that a server may wait for them to complete before shutting down. The zero
+// value is ready to use.
+type Drain struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // closed when n returns to zero; nil while idle
+}
+
+// Middleware returns middleware which counts each request as in flight until
+// the next handler returns, or panics.
+func (d *Drain) Middleware() Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			d.enter()
+			defer d.exit()
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// InFlight returns the number of requests currently in flight.
+func (d *Drain) InFlight() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.n
+}
+
+// Wait blocks until no requests are in flight, or ctx is done, in which case
+// it returns the context's error.
+func (d *Drain) Wait(ctx context.Context) error {
+	d.mu.Lock()
+	idle := d.idle
+	d.mu.Unlock()
+	if idle == nil {
+		return nil
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Drain) enter() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.n == 0 {
+		d.idle = make(chan struct{})
+	}
+	d.n++
+}
+
+func (d *Drain) exit() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.n--
+	if d.n == 0 {
+		close(d.idle)
+		d.idle = nil
+	}
+}
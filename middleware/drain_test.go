@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainIdle(t *testing.T) {
+	var d Drain
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Equal(t, 0, d.InFlight())
+	assert.NoError(t, d.Wait(ctx), "Wait should return immediately when idle.")
+}
+
+func TestDrainInFlight(t *testing.T) {
+	var d Drain
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	h := d.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	<-entered
+	assert.Equal(t, 1, d.InFlight())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.Wait(ctx), context.DeadlineExceeded,
+		"Wait should block while a request is in flight.")
+
+	close(release)
+	<-served
+	assert.NoError(t, d.Wait(context.Background()))
+	assert.Equal(t, 0, d.InFlight())
+}
+
+func TestDrainPanic(t *testing.T) {
+	var d Drain
+	h := d.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	}))
+	assert.Panics(t, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+	assert.Equal(t, 0, d.InFlight(), "Panicking requests should no longer be in flight.")
+}
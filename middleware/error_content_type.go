@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// ErrorContentType returns middleware which sets the Content-Type of any
+// error response (one with a status of 400 or above) to that negotiated for
+// the request by negotiate if the handler didn't set one itself. Pass
+// httpext.NegotiateErrorContentType to match the responses written by an
+// httperror.Responder in the media type negotiated from the request's Accept
+// header. negotiate is only called for error responses.
+func ErrorContentType(negotiate func(req *http.Request) string) Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			rw := NewResponseWriter(w)
+			rw.beforeWriteHeader = func(status int) {
+				if status >= 400 && rw.Header().Get("Content-Type") == "" {
+					rw.Header().Set("Content-Type", negotiate(req))
+				}
+			}
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
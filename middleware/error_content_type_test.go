@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kenkeiter/httpext/httperror"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorContentType(t *testing.T) {
+	// negotiate stands in for httpext.NegotiateErrorContentType, which can't
+	// be imported here
+	mw := ErrorContentType(func(req *http.Request) string {
+		if req.Header.Get("Accept") == httperror.MediaTypeText {
+			return httperror.ContentTypeText
+		}
+		return httperror.ContentType
+	})
+	accept := ""
+	serve := func(f http.HandlerFunc) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", accept)
+		mw(f).ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := serve(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"id":"bad_request"}`))
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, httperror.ContentType, resp.Header().Get("Content-Type"),
+		"Error responses without a Content-Type should receive the default.")
+
+	accept = httperror.MediaTypeText
+	resp = serve(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	assert.Equal(t, httperror.ContentTypeText, resp.Header().Get("Content-Type"),
+		"Error responses should receive the negotiated Content-Type.")
+
+	resp = serve(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	assert.Equal(t, "text/plain", resp.Header().Get("Content-Type"),
+		"Error responses with a Content-Type should keep it.")
+
+	resp = serve(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	assert.Equal(t, "", resp.Header().Get("Content-Type"),
+		"Successful responses should not be modified.")
+}
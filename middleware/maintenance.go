@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/kenkeiter/httpext/httperror"
+)
+
+// ErrMaintenance is written in response to requests received while the
+// service is down for maintenance.
+var ErrMaintenance = httperror.New(http.StatusServiceUnavailable, "maintenance",
+	"The service is down for maintenance.")
+
+// Maintenance returns middleware which, while enabled is set, answers requests
+// with ErrMaintenance and a Retry-After header of retryAfter, rounded up to the
+// second. Requests for any of the allowed paths, such as health checks, are
+// always passed through. Since enabled is consulted for every request,
+// maintenance mode may be toggled without restarting the server.
+func Maintenance(enabled *atomic.Bool, retryAfter time.Duration, allowed ...string) Handler {
+	allow := make(map[string]struct{}, len(allowed))
+	for _, p := range allowed {
+		allow[p] = struct{}{}
+	}
+	retry := strconv.FormatInt(int64((retryAfter+time.Second-1)/time.Second), 10)
+	responder := &httperror.Responder{}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if _, ok := allow[req.URL.Path]; ok || !enabled.Load() {
+				next.ServeHTTP(w, req)
+				return
+			}
+			w.Header().Set("Retry-After", retry)
+			responder.Write(w, ErrMaintenance)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenance(t *testing.T) {
+	var enabled atomic.Bool
+	h := Maintenance(&enabled, 90*time.Second, "/healthz")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest("GET", path, nil))
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/").Code, "Requests should pass through while disabled.")
+
+	enabled.Store(true)
+	resp := serve("/")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code, "Requests should be refused while enabled.")
+	assert.Equal(t, "90", resp.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"id":"maintenance","i18n_key":"error.maintenance","message":"The service is down for maintenance."}`,
+		resp.Body.String())
+	assert.Equal(t, http.StatusOK, serve("/healthz").Code,
+		"Allowed paths should pass through while enabled.")
+
+	enabled.Store(false)
+	assert.Equal(t, http.StatusOK, serve("/").Code, "Maintenance mode should be toggled off.")
+}
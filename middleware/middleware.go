@@ -1,9 +1,14 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 )
 
+// ErrIndexOutOfRange is returned when middleware is inserted into a Set at a
+// position outside of its bounds.
+var ErrIndexOutOfRange = errors.New("middleware index out of range")
+
 type Handler func(http.Handler) http.Handler
 type Set struct {
 	m []Handler
@@ -14,6 +19,11 @@ func (m *Set) Empty() bool {
 	return len(m.m) == 0
 }
 
+// Len returns the number of middleware defined.
+func (m *Set) Len() int {
+	return len(m.m)
+}
+
 // Use allows the registration of one or more middleware http.Handlers that are
 // aware of the middleware chain.
 //
@@ -23,6 +33,21 @@ func (m *Set) Use(newMiddleware Handler) {
 	m.m = append(m.m, newMiddleware)
 }
 
+// InsertAt registers middleware at the given position in the chain, such that
+// it is executed after the first index middleware defined so far, and before
+// the rest. An index of 0 inserts at the head of the chain, and one of Len at
+// its tail; InsertAt returns ErrIndexOutOfRange for any other index outside
+// of these bounds.
+func (m *Set) InsertAt(index int, h Handler) error {
+	if index < 0 || index > len(m.m) {
+		return ErrIndexOutOfRange
+	}
+	m.m = append(m.m, nil)
+	copy(m.m[index+1:], m.m[index:])
+	m.m[index] = h
+	return nil
+}
+
 // UseHandler allows the registration of one or more http.Handler interfaces
 // that will be executed before the primary request handler.
 //
@@ -48,3 +73,8 @@ func (m *Set) Apply(h http.Handler) http.Handler {
 	}
 	return n
 }
+
+// ApplyFunc applies middleware to a handler function.
+func (m *Set) ApplyFunc(f http.HandlerFunc) http.Handler {
+	return m.Apply(f)
+}
@@ -37,3 +37,51 @@ func TestSet(t *testing.T) {
 	assert.Equal(t, []int{0, 1, 2, 3}, checks, "HandlerFunc chain should run completely.")
 
 }
+
+func TestSetApplyFunc(t *testing.T) {
+	ms := &Set{}
+	checks := []int{}
+	ms.Use(func(n http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			checks = append(checks, 0)
+			n.ServeHTTP(w, r)
+		})
+	})
+
+	hnd := ms.ApplyFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks = append(checks, 1)
+	})
+	hnd.ServeHTTP(nil, nil)
+	assert.Equal(t, []int{0, 1}, checks, "Middleware should run before the handler function.")
+}
+
+// tracer returns middleware which records id in checks before continuing the
+// chain.
+func tracer(checks *[]int, id int) Handler {
+	return func(n http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*checks = append(*checks, id)
+			n.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestSetInsertAt(t *testing.T) {
+	ms := &Set{}
+	checks := []int{}
+	ms.Use(tracer(&checks, 1))
+	ms.Use(tracer(&checks, 3))
+	assert.Equal(t, 2, ms.Len())
+
+	assert.NoError(t, ms.InsertAt(0, tracer(&checks, 0)), "Inserting at the head should succeed.")
+	assert.NoError(t, ms.InsertAt(2, tracer(&checks, 2)), "Inserting in the middle should succeed.")
+	assert.NoError(t, ms.InsertAt(ms.Len(), tracer(&checks, 4)), "Inserting at the tail should succeed.")
+	assert.Equal(t, 5, ms.Len())
+
+	assert.Equal(t, ErrIndexOutOfRange, ms.InsertAt(-1, tracer(&checks, -1)))
+	assert.Equal(t, ErrIndexOutOfRange, ms.InsertAt(6, tracer(&checks, 6)))
+	assert.Equal(t, 5, ms.Len(), "Failed insertions should not modify the set.")
+
+	ms.ApplyFunc(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(nil, nil)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, checks, "Middleware should run in positional order.")
+}
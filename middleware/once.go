@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+type onceKey string
+
+// Once wraps the middleware h so that it runs at most once per request, even
+// if it appears in a chain more than once -- as can happen when Sets are
+// composed. Middleware are identified by name; the second and subsequent
+// encounters with a name pass the request directly to the next handler.
+func Once(name string, h Handler) Handler {
+	key := onceKey(name)
+	return func(next http.Handler) http.Handler {
+		wrapped := h(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Context().Value(key) != nil {
+				next.ServeHTTP(w, req)
+				return
+			}
+			ctx := context.WithValue(req.Context(), key, true)
+			wrapped.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
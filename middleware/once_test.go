@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnce(t *testing.T) {
+	checks := []string{}
+	counter := func(label string) Handler {
+		return func(n http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				checks = append(checks, label)
+				n.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	cors := Once("cors", counter("cors"))
+	ms := &Set{}
+	ms.Use(cors)
+	ms.Use(Once("auth", counter("auth")))
+	ms.Use(cors)
+	hnd := ms.ApplyFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks = append(checks, "handler")
+	})
+
+	hnd.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, []string{"cors", "auth", "handler"}, checks,
+		"Middleware wrapped with Once should run once per request.")
+
+	checks = checks[:0]
+	hnd.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, []string{"cors", "auth", "handler"}, checks,
+		"Middleware wrapped with Once should run again for subsequent requests.")
+}
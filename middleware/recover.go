@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/kenkeiter/httpext/httperror"
+)
+
+// ErrInternal is written in response to requests whose handlers panic.
+var ErrInternal = httperror.New(http.StatusInternalServerError, "internal_error",
+	"An internal error occurred.")
+
+// RecoveryDetail is the detail of the ErrInternal written by Recover, allowing
+// users to quote the ID of a failed request when contacting support.
+type RecoveryDetail struct {
+	RequestID string `json:"request_id"`
+}
+
+// Recover returns middleware which recovers from panics in the rest of the
+// chain. The panic and its stack are logged with logf along with the ID
+// assigned to the request by RequestID, if any, and the client is sent an
+// ErrInternal carrying the request ID, but no details of the panic itself. If
+// the response has already been started, it is left as it is.
+//
+// Panics with http.ErrAbortHandler are not recovered.
+func Recover(logf func(format string, args ...interface{})) Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			rw := NewResponseWriter(w)
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				id := RequestIDFromContext(req.Context())
+				logf("panic serving %s %s (request %q): %v\n%s", req.Method, req.URL, id, v, debug.Stack())
+				if rw.Status() != 0 {
+					return
+				}
+				err := ErrInternal
+				if id != "" {
+					err = err.WithDetail(RecoveryDetail{RequestID: id})
+				}
+				(&httperror.Responder{}).Write(rw, err)
+			}()
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
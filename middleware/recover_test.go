@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recoverTest serves req through RequestID and Recover middleware to a
+// handler which panics, returning the response and the logged output.
+func recoverTest(req *http.Request, h http.HandlerFunc) (*httptest.ResponseRecorder, string) {
+	var logged string
+	logf := func(format string, args ...interface{}) {
+		logged += fmt.Sprintf(format, args...)
+	}
+	ms := &Set{}
+	ms.Use(RequestID())
+	ms.Use(Recover(logf))
+	w := httptest.NewRecorder()
+	ms.Apply(h).ServeHTTP(w, req)
+	return w, logged
+}
+
+func TestRecover(t *testing.T) {
+	req := httptest.NewRequest("GET", "/widgets", nil)
+	req.Header.Set(HeaderNameRequestID, "req-8675309")
+	resp, logged := recoverTest(req, func(w http.ResponseWriter, r *http.Request) {
+		panic("secret database password is hunter2")
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code, "Panics should result in a 500.")
+	assert.JSONEq(t, `{"id":"internal_error","i18n_key":"error.internal_error","message":"An internal error occurred.",`+
+		`"detail":{"request_id":"req-8675309"}}`, resp.Body.String(),
+		"The client should receive the request ID.")
+	assert.NotContains(t, resp.Body.String(), "hunter2", "The panic should not reach the client.")
+	assert.NotContains(t, resp.Body.String(), "goroutine", "The stack should not reach the client.")
+
+	assert.Contains(t, logged, "req-8675309", "The request ID should be logged.")
+	assert.Contains(t, logged, "hunter2", "The panic should be logged.")
+	assert.Contains(t, logged, "goroutine", "The stack should be logged.")
+}
+
+func TestRecoverStartedResponse(t *testing.T) {
+	req := httptest.NewRequest("GET", "/widgets", nil)
+	resp, logged := recoverTest(req, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		panic("oops")
+	})
+
+	assert.Equal(t, http.StatusAccepted, resp.Code, "A started response should be left alone.")
+	assert.Equal(t, "partial", resp.Body.String(), "A started response should be left alone.")
+	assert.Contains(t, logged, "oops", "The panic should be logged.")
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	req := httptest.NewRequest("GET", "/widgets", nil)
+	assert.Panics(t, func() {
+		recoverTest(req, func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		})
+	}, "http.ErrAbortHandler should not be recovered.")
+}
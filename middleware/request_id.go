@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// HeaderNameRequestID is the header carrying a request's ID.
+const HeaderNameRequestID = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID returns middleware which assigns each request an ID, making it
+// available through RequestIDFromContext and echoing it in the response's
+// X-Request-ID header. An ID provided by the client in the request's
+// X-Request-ID header is used if it's valid -- at most 128 letters, digits,
+// periods, underscores, and hyphens -- so that clients can't inject arbitrary
+// strings into responses and logs; otherwise a random ID is generated.
+func RequestID() Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			id := req.Header.Get(HeaderNameRequestID)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(HeaderNameRequestID, id)
+			ctx := context.WithValue(req.Context(), requestIDKey{}, id)
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDFromContext returns the ID assigned to a request by RequestID, or
+// "" if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// maxRequestIDLength is the length of the longest request ID accepted from a
+// client.
+const maxRequestIDLength = 128
+
+// validRequestID reports whether id is acceptable as a client-provided request
+// ID.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		switch c := id[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
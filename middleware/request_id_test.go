@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func requestIDTest(req *http.Request) (*httptest.ResponseRecorder, string) {
+	var id string
+	h := RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = RequestIDFromContext(r.Context())
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w, id
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	resp, id := requestIDTest(req)
+	assert.Len(t, id, 32, "A request ID should be generated.")
+	assert.Equal(t, id, resp.Header().Get(HeaderNameRequestID),
+		"The request ID should be echoed in the response.")
+
+	_, other := requestIDTest(req)
+	assert.NotEqual(t, id, other, "Each request should be assigned a new ID.")
+}
+
+func TestRequestIDProvided(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderNameRequestID, "abc123")
+	resp, id := requestIDTest(req)
+	assert.Equal(t, "abc123", id, "A client-provided request ID should be used.")
+	assert.Equal(t, "abc123", resp.Header().Get(HeaderNameRequestID),
+		"The request ID should be echoed in the response.")
+	assert.Empty(t, RequestIDFromContext(req.Context()),
+		"Requests without an assigned ID should have an empty ID.")
+}
+
+func TestRequestIDRejected(t *testing.T) {
+	for _, provided := range []string{
+		"abc 123",
+		"abc\r\nX-Injected: 1",
+		`{"id":"forged"}`,
+		strings.Repeat("a", 129),
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header[HeaderNameRequestID] = []string{provided}
+		resp, id := requestIDTest(req)
+		assert.Len(t, id, 32, "A new ID should be generated in place of %q.", provided)
+		assert.Equal(t, id, resp.Header().Get(HeaderNameRequestID),
+			"The generated ID should be echoed in the response.")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderNameRequestID, strings.Repeat("a", 128))
+	_, id := requestIDTest(req)
+	assert.Equal(t, strings.Repeat("a", 128), id, "IDs of up to 128 characters should be accepted.")
+}
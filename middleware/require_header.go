@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/kenkeiter/httpext/httperror"
+)
+
+var (
+	// ErrMissingHeader is written in response to requests lacking a header
+	// required by RequireHeader. Its detail names the header.
+	ErrMissingHeader = httperror.New(http.StatusBadRequest, "missing_header",
+		"A required header is missing.")
+
+	// ErrInvalidHeader is written in response to requests whose value for a
+	// header required by RequireHeader fails validation. Its detail names the
+	// header.
+	ErrInvalidHeader = httperror.New(http.StatusBadRequest, "invalid_header",
+		"A required header has an invalid value.")
+)
+
+// RequireHeader returns middleware which answers requests without the header
+// name -- an API key or tenant ID, say -- with ErrMissingHeader, and those
+// whose value for it fails validate with ErrInvalidHeader. Other requests are
+// passed through. If validate is nil, any value is accepted. RequireHeader is
+// a guard against malformed requests rather than a means of authentication.
+func RequireHeader(name string, validate func(value string) bool) Handler {
+	detail := map[string]string{"header": http.CanonicalHeaderKey(name)}
+	missing := ErrMissingHeader.WithDetail(detail)
+	invalid := ErrInvalidHeader.WithDetail(detail)
+	responder := &httperror.Responder{}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			value := req.Header.Get(name)
+			switch {
+			case value == "":
+				responder.Write(w, missing)
+			case validate != nil && !validate(value):
+				responder.Write(w, invalid)
+			default:
+				next.ServeHTTP(w, req)
+			}
+		})
+	}
+}
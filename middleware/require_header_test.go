@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireHeader(t *testing.T) {
+	h := RequireHeader("x-tenant-id", func(v string) bool { return strings.HasPrefix(v, "t_") })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	serve := func(value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if value != "" {
+			req.Header.Set("X-Tenant-ID", value)
+		}
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := serve("")
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "Requests without the header should be refused.")
+	assert.JSONEq(t, `{"id":"missing_header","i18n_key":"error.missing_header",`+
+		`"message":"A required header is missing.","detail":{"header":"X-Tenant-Id"}}`, resp.Body.String())
+
+	resp = serve("acme")
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "Requests with an invalid value should be refused.")
+	assert.JSONEq(t, `{"id":"invalid_header","i18n_key":"error.invalid_header",`+
+		`"message":"A required header has an invalid value.","detail":{"header":"X-Tenant-Id"}}`, resp.Body.String())
+
+	assert.Equal(t, http.StatusOK, serve("t_acme").Code, "Requests with a valid value should pass through.")
+}
+
+func TestRequireHeaderPresence(t *testing.T) {
+	h := RequireHeader("X-API-Key", nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/", nil)
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	req.Header.Set("X-API-Key", "anything")
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code, "Any value should be accepted without a validator.")
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// ResponseWriter wraps an http.ResponseWriter, recording the status code, the
+// number of bytes written, and the time to first byte so that logging and
+// metrics middleware can report on a response once it has been served.
+//
+// Header returns the underlying header map, so trailers -- whether declared
+// in the Trailer header or set using http.TrailerPrefix -- are delivered as
+// they would be without the wrapper.
+type ResponseWriter struct {
+	http.ResponseWriter
+
+	start  time.Time
+	status int
+	bytes  int64
+	ttfb   time.Duration
+
+	// beforeWriteHeader, if set, is called with the status code just before
+	// the header is written, while it may still be modified.
+	beforeWriteHeader func(status int)
+}
+
+// NewResponseWriter wraps w. Time to first byte is measured from the moment
+// NewResponseWriter is called.
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w, start: time.Now()}
+}
+
+// WriteHeader records the status code and writes it to the underlying
+// http.ResponseWriter.
+func (w *ResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		if w.beforeWriteHeader != nil {
+			w.beforeWriteHeader(status)
+		}
+		w.status = status
+		w.ttfb = time.Since(w.start)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes b to the underlying http.ResponseWriter, writing an implicit
+// http.StatusOK header first if no header has been written yet.
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush sends any buffered data to the client, if the underlying
+// http.ResponseWriter supports it.
+func (w *ResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for use by
+// http.ResponseController.
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the status code of the response, or 0 if no header has been
+// written yet.
+func (w *ResponseWriter) Status() int {
+	return w.status
+}
+
+// BytesWritten returns the number of bytes of body written so far.
+func (w *ResponseWriter) BytesWritten() int64 {
+	return w.bytes
+}
+
+// TTFB returns the time elapsed between wrapping the http.ResponseWriter and
+// the first write to it, or 0 if nothing has been written yet.
+func (w *ResponseWriter) TTFB() time.Duration {
+	return w.ttfb
+}
+
+// Elapsed returns the time elapsed since the http.ResponseWriter was wrapped.
+func (w *ResponseWriter) Elapsed() time.Duration {
+	return time.Since(w.start)
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseWriterRecordsResponse(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := NewResponseWriter(rec)
+	assert.Equal(t, 0, w.Status(), "Status should be unset before anything is written.")
+	assert.Equal(t, time.Duration(0), w.TTFB(), "TTFB should be unset before anything is written.")
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("hello, "))
+	w.Write([]byte("world"))
+
+	assert.Equal(t, http.StatusCreated, w.Status(), "Status should match the written header.")
+	assert.Equal(t, int64(12), w.BytesWritten(), "All written bytes should be counted.")
+	assert.Equal(t, http.StatusCreated, rec.Code, "Status should be passed through.")
+	assert.Equal(t, "hello, world", rec.Body.String(), "Body should be passed through.")
+}
+
+func TestResponseWriterImplicitStatus(t *testing.T) {
+	w := NewResponseWriter(httptest.NewRecorder())
+	w.Write([]byte("ok"))
+	assert.Equal(t, http.StatusOK, w.Status(), "Writing a body should imply a 200 status.")
+}
+
+func TestResponseWriterTTFB(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	w := NewResponseWriter(httptest.NewRecorder())
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		time.Sleep(delay)
+		w.Write([]byte("second"))
+	})
+	start := time.Now()
+	h.ServeHTTP(w, nil)
+	total := time.Since(start)
+
+	assert.True(t, w.TTFB() > 0, "TTFB should be recorded.")
+	assert.True(t, w.TTFB() < delay, "TTFB should be recorded at the first write.")
+	assert.True(t, total >= delay, "Handler should complete after the delay.")
+}
+
+func TestResponseWriterTrailers(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = NewResponseWriter(w)
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("streamed body"))
+		w.Header().Set("X-Checksum", "abc123")
+		w.Header().Set(http.TrailerPrefix+"X-Undeclared", "def456")
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err, "Body should be readable.")
+	assert.Equal(t, "streamed body", string(body), "Body should be passed through.")
+	assert.Equal(t, "abc123", resp.Trailer.Get("X-Checksum"),
+		"Declared trailers should be delivered through the wrapper.")
+	assert.Equal(t, "def456", resp.Trailer.Get("X-Undeclared"),
+		"TrailerPrefix trailers should be delivered through the wrapper.")
+}
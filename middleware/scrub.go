@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// Redacted replaces the values of scrubbed headers.
+const Redacted = "***"
+
+type scrubKey struct{}
+
+// ScrubHeaders returns middleware which marks the named headers -- such as
+// Authorization or Cookie -- as secret for the rest of the chain. Headers
+// aren't modified; rather, logging middleware further down the chain should
+// record the snapshot returned by ScrubbedHeader, in which their values are
+// redacted, in place of the request or response headers themselves. Names
+// given by multiple ScrubHeaders in a chain accumulate.
+func ScrubHeaders(names ...string) Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			scrubbed := append(scrubbedNames(req.Context()), names...)
+			ctx := context.WithValue(req.Context(), scrubKey{}, scrubbed)
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// ScrubbedHeader returns a copy of h -- the request's headers, or those of its
+// response -- in which the values of the headers marked by ScrubHeaders for req
+// are replaced with Redacted. h itself is left unmodified.
+func ScrubbedHeader(req *http.Request, h http.Header) http.Header {
+	return Scrub(h, scrubbedNames(req.Context())...)
+}
+
+// Scrub returns a copy of h in which the values of the named headers are
+// replaced with Redacted. Names are matched case-insensitively.
+func Scrub(h http.Header, names ...string) http.Header {
+	c := h.Clone()
+	for _, name := range names {
+		key := http.CanonicalHeaderKey(name)
+		values := c[key]
+		if len(values) == 0 {
+			continue
+		}
+		redacted := make([]string, len(values))
+		for i := range redacted {
+			redacted[i] = Redacted
+		}
+		c[key] = redacted
+	}
+	return c
+}
+
+func scrubbedNames(ctx context.Context) []string {
+	names, _ := ctx.Value(scrubKey{}).([]string)
+	// copy, so that appending to the names never modifies those of another
+	// request sharing the slice
+	return append([]string(nil), names...)
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrubHeaders(t *testing.T) {
+	var loggedReq, loggedResp http.Header
+	logging := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(w, req)
+			loggedReq = ScrubbedHeader(req, req.Header)
+			loggedResp = ScrubbedHeader(req, w.Header())
+		})
+	}
+	var seen string
+	ms := &Set{}
+	ms.Use(ScrubHeaders("authorization", "Cookie"))
+	ms.Use(ScrubHeaders("Set-Cookie"))
+	ms.Use(logging)
+	h := ms.ApplyFunc(func(w http.ResponseWriter, req *http.Request) {
+		seen = req.Header.Get("Authorization")
+		w.Header().Add("Set-Cookie", "session=abc")
+		w.Header().Add("Set-Cookie", "theme=dark")
+		w.Header().Set("Content-Type", "text/plain")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Accept", "text/plain")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	assert.Equal(t, "Bearer secret", seen, "Handlers should receive the real header.")
+	assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"), "The request should not be modified.")
+	assert.Equal(t, Redacted, loggedReq.Get("Authorization"), "Authorization should be scrubbed in the log.")
+	assert.Equal(t, "text/plain", loggedReq.Get("Accept"), "Other headers should be logged as they are.")
+	assert.Empty(t, loggedReq.Values("Cookie"), "Absent headers should not be added.")
+
+	assert.Equal(t, []string{"session=abc", "theme=dark"}, w.Header().Values("Set-Cookie"),
+		"The response should be sent with the real header.")
+	assert.Equal(t, []string{Redacted, Redacted}, loggedResp.Values("Set-Cookie"),
+		"Set-Cookie should be scrubbed in the log.")
+	assert.Equal(t, "text/plain", loggedResp.Get("Content-Type"))
+}
+
+func TestScrubbedHeaderWithoutScrubHeaders(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	assert.Equal(t, "Bearer secret", ScrubbedHeader(req, req.Header).Get("Authorization"),
+		"Nothing should be scrubbed unless marked.")
+}
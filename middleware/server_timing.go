@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderNameServerTiming is the header in which ServerTiming reports timings.
+const HeaderNameServerTiming = "Server-Timing"
+
+type serverTimingKey struct{}
+
+// serverTimings accumulates the timings recorded for a request.
+type serverTimings struct {
+	mu      sync.Mutex
+	metrics []string
+}
+
+// ServerTiming returns middleware which reports the timings recorded with
+// AddTiming while serving each request in the response's Server-Timing header,
+// for inspection in a browser's developer tools. The header is written just
+// before the response header, so only timings recorded until then -- before
+// the first write to the response -- are reported.
+func ServerTiming() Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Context().Value(serverTimingKey{}) != nil {
+				// timings are already being reported further up the chain
+				next.ServeHTTP(w, req)
+				return
+			}
+			timings := &serverTimings{}
+			rw := NewResponseWriter(w)
+			rw.beforeWriteHeader = func(int) {
+				timings.write(rw.Header())
+			}
+			ctx := context.WithValue(req.Context(), serverTimingKey{}, timings)
+			next.ServeHTTP(rw, req.WithContext(ctx))
+			if rw.Status() == 0 {
+				// nothing has been written; the header will be written once
+				// the handler returns
+				timings.write(rw.Header())
+			}
+		})
+	}
+}
+
+// AddTiming records a timing of d, identified by name, to be reported by
+// ServerTiming for the request with context ctx, such as "db;dur=12.5" for a
+// name of "db" and a duration of 12.5ms. name must be a valid HTTP token.
+// AddTiming does nothing unless the request is served by ServerTiming. It may
+// be called concurrently.
+func AddTiming(ctx context.Context, name string, d time.Duration) {
+	timings, ok := ctx.Value(serverTimingKey{}).(*serverTimings)
+	if !ok {
+		return
+	}
+	ms := float64(d.Round(time.Microsecond)) / float64(time.Millisecond)
+	metric := name + ";dur=" + strconv.FormatFloat(ms, 'f', -1, 64)
+	timings.mu.Lock()
+	timings.metrics = append(timings.metrics, metric)
+	timings.mu.Unlock()
+}
+
+func (t *serverTimings) write(h http.Header) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.metrics) > 0 {
+		h.Add(HeaderNameServerTiming, strings.Join(t.metrics, ", "))
+	}
+}
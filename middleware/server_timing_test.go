@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerTiming(t *testing.T) {
+	ms := &Set{}
+	ms.Use(ServerTiming())
+	ms.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			AddTiming(req.Context(), "auth", 2*time.Millisecond)
+			next.ServeHTTP(w, req)
+		})
+	})
+	h := ms.ApplyFunc(func(w http.ResponseWriter, req *http.Request) {
+		AddTiming(req.Context(), "db", 12500*time.Microsecond)
+		AddTiming(req.Context(), "render", 333*time.Microsecond+400*time.Nanosecond)
+		w.Write([]byte("ok"))
+		AddTiming(req.Context(), "late", time.Millisecond)
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "auth;dur=2, db;dur=12.5, render;dur=0.333", w.Header().Get(HeaderNameServerTiming),
+		"Timings recorded before the response is written should be reported in order.")
+}
+
+func TestServerTimingWithoutWrite(t *testing.T) {
+	h := ServerTiming()(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		AddTiming(req.Context(), "cache", 0)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "cache;dur=0", w.Header().Get(HeaderNameServerTiming))
+
+	h = ServerTiming()(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Empty(t, w.Header().Values(HeaderNameServerTiming), "No header should be written without timings.")
+
+	// without the middleware, timings are discarded
+	AddTiming(context.Background(), "db", time.Millisecond)
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// SingleFlight returns middleware which coalesces concurrent GET requests
+// sharing a key, as returned by keyFunc, so that the next handler serves only
+// one of them; the response it writes is buffered in full, and replayed to
+// every request waiting on it. Requests for which keyFunc returns "", and
+// requests with methods other than GET, are served individually.
+//
+// Since a single response is shared, keyFunc must distinguish any requests
+// for which the handler's response may differ -- by URL, or by credentials,
+// for example. The handler sees only the request which arrived first, and runs
+// under its context.
+func SingleFlight(keyFunc func(*http.Request) string) Handler {
+	var g singleflight.Group
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			key := ""
+			if req.Method == "GET" {
+				key = keyFunc(req)
+			}
+			if key == "" {
+				next.ServeHTTP(w, req)
+				return
+			}
+			v, _, _ := g.Do(key, func() (interface{}, error) {
+				b := newBufferedResponse()
+				next.ServeHTTP(b, req)
+				return b, nil
+			})
+			v.(*bufferedResponse).replay(w)
+		})
+	}
+}
+
+// bufferedResponse is an http.ResponseWriter which buffers a response in
+// full, so that it may be replayed to any number of clients.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header)}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// replay writes the buffered response to w.
+func (b *bufferedResponse) replay(w http.ResponseWriter) {
+	h := w.Header()
+	for k, v := range b.header {
+		h[k] = append([]string(nil), v...)
+	}
+	status := b.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(b.body.Bytes())
+}
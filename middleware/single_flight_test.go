@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSingleFlight(t *testing.T) {
+	const n = 10
+	var runs int32
+	var arrived sync.WaitGroup
+	arrived.Add(n)
+	release := make(chan struct{})
+
+	mw := SingleFlight(func(r *http.Request) string { return r.URL.String() })
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&runs, 1)
+		<-release
+		w.Header().Set("X-Test", "shared")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("hello"))
+	}))
+	// count each request in as it enters the middleware, so that the handler
+	// is released only once all requests are waiting on it
+	counted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		h.ServeHTTP(w, r)
+	})
+
+	resps := make([]*httptest.ResponseRecorder, n)
+	var done sync.WaitGroup
+	for i := range resps {
+		resps[i] = httptest.NewRecorder()
+		done.Add(1)
+		go func(resp *httptest.ResponseRecorder) {
+			defer done.Done()
+			counted.ServeHTTP(resp, httptest.NewRequest("GET", "/expensive", nil))
+		}(resps[i])
+	}
+	arrived.Wait()
+	// allow the requests to reach the shared execution of the handler
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	done.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs),
+		"Concurrent requests should share a handler execution.")
+	for _, resp := range resps {
+		assert.Equal(t, http.StatusAccepted, resp.Code)
+		assert.Equal(t, "shared", resp.Header().Get("X-Test"))
+		assert.Equal(t, "hello", resp.Body.String())
+	}
+}
+
+func TestSingleFlightBypass(t *testing.T) {
+	var runs int32
+	mw := SingleFlight(func(r *http.Request) string { return r.URL.Query().Get("key") })
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&runs, 1)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/?key=a", nil))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs),
+		"Requests without a key, and non-GET requests, should be served individually.")
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// SlowLog returns middleware which calls log for each request taking longer
+// than threshold to serve, with the time it took.
+func SlowLog(threshold time.Duration, log func(r *http.Request, d time.Duration)) Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			rw := NewResponseWriter(w)
+			next.ServeHTTP(rw, req)
+			if d := rw.Elapsed(); d > threshold {
+				log(req, d)
+			}
+		})
+	}
+}
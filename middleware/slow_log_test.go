@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowLog(t *testing.T) {
+	const threshold = 20 * time.Millisecond
+	var logged []time.Duration
+	mw := SlowLog(threshold, func(r *http.Request, d time.Duration) {
+		logged = append(logged, d)
+	})
+
+	fast := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	fast.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fast", nil))
+	assert.Empty(t, logged, "Fast requests should not be logged.")
+
+	slow := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * threshold)
+	}))
+	slow.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	assert.Len(t, logged, 1, "Slow requests should be logged.")
+	assert.True(t, len(logged) == 1 && logged[0] >= 2*threshold,
+		"The logged duration should cover the whole request.")
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// TeeOptions configures Tee. Limits which are zero take the defaults below.
+type TeeOptions struct {
+	// MaxBodySize is the largest request body, in bytes, which is buffered for
+	// mirroring (1 MiB by default). Requests with larger bodies aren't
+	// mirrored; their bodies are streamed to the next handler as usual.
+	MaxBodySize int64
+
+	// MaxConcurrent is the number of mirrored requests which may be in flight
+	// at once (64 by default). Requests arriving while as many are in flight
+	// aren't mirrored.
+	MaxConcurrent int
+
+	// Timeout bounds each mirrored request (10 seconds by default), by way of
+	// the deadline of its context.
+	Timeout time.Duration
+
+	// Logf, if set, is called to report panics in the mirror, along with
+	// their stacks.
+	Logf func(format string, args ...interface{})
+}
+
+// Tee returns middleware which mirrors each request to mirror, such as a new
+// backend being shadow-tested, while the next handler serves the client as
+// usual. The request body is buffered so that both handlers may read it in
+// full. The mirror is invoked once the next handler has returned, in its own
+// goroutine, with a response writer which discards everything written to it;
+// its request carries the values of the original request's context, but is
+// not cancelled along with it. Panics in the mirror are recovered, so that
+// they can't affect the primary path, and reported with opts.Logf.
+//
+// Mirroring is best-effort: requests are not mirrored should their bodies
+// exceed opts.MaxBodySize, or should opts.MaxConcurrent mirrored requests be
+// in flight already.
+func Tee(mirror http.Handler, opts TeeOptions) Handler {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 64
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	inFlight := make(chan struct{}, opts.MaxConcurrent)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var body []byte
+			if req.Body != nil && req.Body != http.NoBody {
+				var err error
+				body, err = io.ReadAll(io.LimitReader(req.Body, opts.MaxBodySize+1))
+				if err != nil {
+					// serve the primary as far as the body could be read
+					req.Body = readCloser{io.MultiReader(bytes.NewReader(body), errReader{err}), req.Body}
+					next.ServeHTTP(w, req)
+					return
+				}
+				if int64(len(body)) > opts.MaxBodySize {
+					// too large to mirror; stream the rest to the primary
+					req.Body = readCloser{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+					next.ServeHTTP(w, req)
+					return
+				}
+				req.Body.Close()
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			mreq := req.Clone(context.WithoutCancel(req.Context()))
+			if body != nil {
+				mreq.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			next.ServeHTTP(w, req)
+
+			select {
+			case inFlight <- struct{}{}:
+			default:
+				// too many mirrored requests are in flight
+				return
+			}
+			go func() {
+				defer func() { <-inFlight }()
+				defer func() {
+					if v := recover(); v != nil && opts.Logf != nil {
+						opts.Logf("panic mirroring %s %s: %v\n%s", mreq.Method, mreq.URL, v, debug.Stack())
+					}
+				}()
+				ctx, cancel := context.WithTimeout(mreq.Context(), opts.Timeout)
+				defer cancel()
+				mirror.ServeHTTP(discardResponseWriter{header: make(http.Header)}, mreq.WithContext(ctx))
+			}()
+		})
+	}
+}
+
+// readCloser reads from one source, closing another, such as a request body
+// part of which has been read ahead.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// errReader is an io.Reader which always fails with err.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// discardResponseWriter is an http.ResponseWriter which discards everything
+// written to it.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w discardResponseWriter) WriteHeader(int) {}
+
+func (w discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
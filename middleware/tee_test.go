@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTee(t *testing.T) {
+	mirrored := make(chan string, 1)
+	mirror := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("mirror"))
+		mirrored <- string(b)
+	})
+	h := Tee(mirror, TeeOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(append([]byte("primary:"), b...))
+	}))
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+	assert.Equal(t, http.StatusCreated, resp.Code, "The client should receive the primary response.")
+	assert.Equal(t, "primary:payload", resp.Body.String())
+
+	select {
+	case body := <-mirrored:
+		assert.Equal(t, "payload", body, "The mirror should receive the request body.")
+	case <-time.After(time.Second):
+		t.Error("The mirror should have been invoked.")
+	}
+}
+
+func TestTeeMirrorPanic(t *testing.T) {
+	logged := make(chan string, 1)
+	mirror := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("mirror failed")
+	})
+	h := Tee(mirror, TeeOptions{Logf: func(format string, args ...interface{}) {
+		logged <- fmt.Sprintf(format, args...)
+	}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "ok", resp.Body.String())
+	select {
+	case msg := <-logged:
+		assert.Contains(t, msg, "mirror failed", "Panics in the mirror should be reported.")
+	case <-time.After(time.Second):
+		t.Error("The panic should have been reported.")
+	}
+}
+
+func TestTeeMaxBodySize(t *testing.T) {
+	mirrored := make(chan struct{}, 1)
+	mirror := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored <- struct{}{}
+	})
+	h := Tee(mirror, TeeOptions{MaxBodySize: 4})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Write(b)
+	}))
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/", strings.NewReader("too large")))
+	assert.Equal(t, "too large", resp.Body.String(), "Large bodies should be streamed to the primary.")
+	select {
+	case <-mirrored:
+		t.Error("Requests with large bodies should not be mirrored.")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/", strings.NewReader("four")))
+	assert.Equal(t, "four", resp.Body.String())
+	select {
+	case <-mirrored:
+	case <-time.After(time.Second):
+		t.Error("Requests with bodies within the limit should be mirrored.")
+	}
+}
+
+func TestTeeMaxConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	mirror := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+	})
+	h := Tee(mirror, TeeOptions{MaxConcurrent: 2})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 5; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls),
+		"Requests beyond the limit of those in flight should not be mirrored.")
+}
+
+func TestTeeTimeout(t *testing.T) {
+	done := make(chan error, 1)
+	mirror := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		done <- r.Context().Err()
+	})
+	h := Tee(mirror, TeeOptions{Timeout: 10 * time.Millisecond})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "Mirrored requests should be bounded by the timeout.")
+	case <-time.After(time.Second):
+		t.Error("The mirrored request should have timed out.")
+	}
+}
@@ -0,0 +1,31 @@
+package httpext
+
+import (
+	"net/http"
+
+	"github.com/kenkeiter/httpext/httperror"
+)
+
+// NegotiateErrorMediaType returns the media type, of those in which an
+// httperror.Responder can write errors (httperror.MediaTypes), best matching
+// the request's Accept header. If none is acceptable, JSON is chosen.
+func NegotiateErrorMediaType(r *http.Request) string {
+	return NegotiateContentType(r, httperror.MediaTypes, httperror.MediaTypeJSON)
+}
+
+// NegotiateErrorContentType returns the Content-Type of an error response to
+// r, in the media type chosen by NegotiateErrorMediaType, such as
+// "text/plain; charset=utf-8".
+func NegotiateErrorContentType(r *http.Request) string {
+	return httperror.ContentTypeFor(NegotiateErrorMediaType(r))
+}
+
+// WriteError writes e to w with responder, in the media type chosen for req by
+// NegotiateErrorMediaType. If responder is nil, a zero-value
+// httperror.Responder is used.
+func WriteError(w http.ResponseWriter, req *http.Request, responder *httperror.Responder, e httperror.Error) error {
+	if responder == nil {
+		responder = &httperror.Responder{}
+	}
+	return responder.WriteAs(w, NegotiateErrorMediaType(req), e)
+}
@@ -0,0 +1,60 @@
+package httpext
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kenkeiter/httpext/httperror"
+	"github.com/kenkeiter/httpext/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+var negotiateErrorMediaTypeTests = []struct {
+	accept string
+	expect string
+}{
+	{"", httperror.MediaTypeJSON},
+	{"application/json", httperror.MediaTypeJSON},
+	{"text/plain", httperror.MediaTypeText},
+	{"text/*", httperror.MediaTypeText},
+	{"*/*", httperror.MediaTypeJSON},
+	{"text/html, text/plain;q=0.5, application/json;q=0.2", httperror.MediaTypeText},
+	{"image/png", httperror.MediaTypeJSON},
+}
+
+func TestNegotiateErrorMediaType(t *testing.T) {
+	for _, tt := range negotiateErrorMediaTypeTests {
+		r := &http.Request{Header: http.Header{"Accept": {tt.accept}}}
+		assert.Equal(t, tt.expect, NegotiateErrorMediaType(r), "NegotiateErrorMediaType(%q)", tt.accept)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	e := httperror.New(http.StatusNotFound, "not_found", "Not found.")
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/plain")
+	w := httptest.NewRecorder()
+	assert.NoError(t, WriteError(w, req, nil, e))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, httperror.ContentTypeText, w.Header().Get("Content-Type"))
+	assert.Equal(t, "Not found.\n", w.Body.String())
+}
+
+func TestNegotiatedErrorContentType(t *testing.T) {
+	h := middleware.ErrorContentType(NegotiateErrorContentType)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	for accept, contentType := range map[string]string{
+		"":                 httperror.ContentType,
+		"text/plain":       httperror.ContentTypeText,
+		"application/json": httperror.ContentType,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		assert.Equal(t, contentType, w.Header().Get("Content-Type"),
+			"Error responses to requests accepting %q should receive the negotiated Content-Type.", accept)
+	}
+}
@@ -3,13 +3,13 @@ package httpext
 import (
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
 	"strconv"
-	// "strings"
+	"strings"
 )
 
-// TODO(kk): When there are 0 records total, response should be Range: */0 and
-//           server should return HTTP 416 Request Not Satisfiable.
-
 var (
 	// ErrRangeIsSuffix indicates that a range is only a suffix, which is a type
 	// of range that indicates a number of records that should be read from
@@ -26,20 +26,93 @@ var (
 	ErrRangeUnsatisfiableZeroLength = errors.New("range can satisfy a " +
 		"zero-length set")
 
+	// ErrRangeUnsatisfiable indicates that a range cannot be satisfied because
+	// the collection it has been constrained to is empty.
+	ErrRangeUnsatisfiable = errors.New("range cannot be satisfied by an " +
+		"empty collection")
+
 	// ErrRangeOutsideConstraints indicates that a specified range includes only
 	// elements outside of the range it has been constrained to.
 	ErrRangeOutsideConstraints = errors.New("range begins outside of the " +
 		"total number of elements")
+
+	// ErrRangeNotFixed indicates that an operation requires a range with both
+	// a first and last index, such as one which has been constrained.
+	ErrRangeNotFixed = errors.New("range must have both a first and last " +
+		"index -- constrain it first")
+
+	// ErrRangeUnitsMismatch indicates that an operation on two ranges requires
+	// them to share the same units.
+	ErrRangeUnitsMismatch = errors.New("ranges must share the same units")
+
+	// ErrRangeUnsupportedUnit indicates that a range is specified in units
+	// which the parser has not been permitted to accept.
+	ErrRangeUnsupportedUnit = errors.New("range units are not supported")
+
+	// ErrRangeValueTooLarge indicates that an index in a range exceeds the
+	// maximum permitted by the parser.
+	ErrRangeValueTooLarge = errors.New("range index exceeds the maximum " +
+		"permitted value")
+)
+
+const (
+	// HeaderNameAcceptRanges is the name of the header advertising the units
+	// in which ranges of a resource may be requested.
+	HeaderNameAcceptRanges = "Accept-Ranges"
+
+	// HeaderNameContentRange is the name of the header describing the range
+	// of a collection included in a response.
+	HeaderNameContentRange = "Content-Range"
+
+	// RangeUnitsBytes is the range unit for byte ranges, as defined by RFC 7233.
+	RangeUnitsBytes = "bytes"
+
+	// RangeUnitsNone indicates, in an Accept-Ranges header, that ranges of a
+	// resource may not be requested.
+	RangeUnitsNone = "none"
 )
 
 const (
 	// RangeUnconstrained is returned whenever a range has not been constrained
 	// in a way that the requested value can be calculated.
-	RangeUnconstrained = -1
+	RangeUnconstrained int64 = -1
+)
+
+// RangeForm describes the form in which a range was originally specified.
+type RangeForm int
+
+const (
+	// RangeFormUnknown indicates that the form of a range is not known, as it
+	// was neither parsed nor created with NewContentRange.
+	RangeFormUnknown RangeForm = iota
+
+	// RangeFormFixed indicates a range with both a first and last index, such
+	// as "resources=0-99".
+	RangeFormFixed
+
+	// RangeFormUnbounded indicates a range with only a first index, such as
+	// "resources=100-".
+	RangeFormUnbounded
+
+	// RangeFormSuffix indicates a range of a number of elements at the end of
+	// a collection, such as "resources=-100".
+	RangeFormSuffix
 )
 
-func NewContentRange(units string, first, last int) (*ContentRange, error) {
-	c := &ContentRange{units: units}
+func (f RangeForm) String() string {
+	switch f {
+	case RangeFormFixed:
+		return "fixed"
+	case RangeFormUnbounded:
+		return "unbounded"
+	case RangeFormSuffix:
+		return "suffix"
+	}
+	return "unknown"
+}
+
+func NewContentRange(units string, first, last int64) (*ContentRange, error) {
+	c := &ContentRange{units: units, form: RangeFormFixed}
 	if err := c.SetFirst(first); err != nil {
 		return nil, err
 	}
@@ -50,21 +123,36 @@ func NewContentRange(units string, first, last int) (*ContentRange, error) {
 }
 
 // ContentRange represents information provided by a Range header, as specified
-// in IETF RFC 7233 (http://tools.ietf.org/html/rfc7233).
+// in IETF RFC 7233 (http://tools.ietf.org/html/rfc7233). Indices and totals are
+// int64s, so that offsets into large files can be represented on any platform.
+// The units of a range are arbitrary: besides indices into a collection, a
+// range may cover any values encoded as integers, such as epoch seconds in
+// "timestamp=1600000000-1600003600"; see ConstrainMax.
+//
+// Both bounds are inclusive, as in the headers themselves: "resources=100-199"
+// has a First of 100 and a Last of 199, and covers Limit() == 100 elements, so
+// that for any fixed range Last()-First()+1 == Limit().
 type ContentRange struct {
 	units string
 
-	first  int
-	last   int
+	first  int64
+	last   int64
 	fBound bool
 	lBound bool
 
-	total  int
+	total  int64
 	tBound bool
+
+	form RangeForm
+
+	maxWindow int64
+	clamped   bool
 }
 
-func (c *ContentRange) SetFirst(first int) error {
-	if c.lBound && c.first >= c.last {
+// SetFirst sets the index of the first element covered by the range. It
+// returns ErrRangeInvalid if first follows the range's last index.
+func (c *ContentRange) SetFirst(first int64) error {
+	if c.lBound && first > c.last {
 		return ErrRangeInvalid
 	}
 	c.first = first
@@ -72,7 +160,10 @@ func (c *ContentRange) SetFirst(first int) error {
 	return nil
 }
 
-func (c *ContentRange) SetLast(last int) error {
+// SetLast sets the index of the last element covered by the range, which is
+// inclusive: a range may begin and end at the same index, covering a single
+// element. It returns ErrRangeInvalid if last precedes the range's first index.
+func (c *ContentRange) SetLast(last int64) error {
 	if c.fBound && last < c.first {
 		return ErrRangeInvalid
 	}
@@ -81,20 +172,31 @@ func (c *ContentRange) SetLast(last int) error {
 	return nil
 }
 
-func (c *ContentRange) First() int {
+// First returns the index of the first element covered by the range, or
+// RangeUnconstrained for a suffix range.
+func (c *ContentRange) First() int64 {
 	if !c.fBound {
 		return RangeUnconstrained
 	}
 	return c.first
 }
 
-func (c *ContentRange) Last() int {
+// Last returns the index of the last element covered by the range (inclusive),
+// or RangeUnconstrained for an unbounded range. For a suffix range, it returns
+// the negated length of the suffix.
+func (c *ContentRange) Last() int64 {
 	if !c.lBound {
 		return RangeUnconstrained
 	}
 	return c.last
 }
 
+// OriginalForm returns the form in which the range was originally specified,
+// which, unlike IsSuffix and IsUnbounded, is unaffected by constraining it.
+func (c *ContentRange) OriginalForm() RangeForm {
+	return c.form
+}
+
 func (c *ContentRange) IsSuffix() bool {
 	return c.fBound == false
 }
@@ -111,9 +213,20 @@ func (c *ContentRange) IsFullRange() bool {
 	return (c.fBound && c.first == 0) && !c.lBound
 }
 
-func (c *ContentRange) Contains(offset int) bool {
+// IsComplete indicates whether the range, once constrained by SetTotal, covers
+// every element of the collection, from index 0 through total-1 -- whatever
+// form it was originally specified in. Servers may respond to requests for
+// complete ranges with the entire collection, rather than partial content.
+func (c *ContentRange) IsComplete() bool {
+	return c.tBound && c.IsFixed() && c.first == 0 && c.last >= c.total-1
+}
+
+// Contains indicates whether the range covers the element at offset, between
+// First and Last inclusive. A negative offset is treated as a suffix length,
+// and is contained by suffix ranges at least as long.
+func (c *ContentRange) Contains(offset int64) bool {
 	if offset < 0 {
-		if !c.fBound {
+		if !c.fBound || offset == math.MinInt64 {
 			return false
 		}
 		return c.last >= -offset
@@ -124,46 +237,254 @@ func (c *ContentRange) Contains(offset int) bool {
 	return (c.first <= offset) && (offset <= c.last)
 }
 
-func (c *ContentRange) Constrain(size int) error {
-	if size == 0 {
-		if !c.fBound {
-			c.last = 0
-			c.lBound = true
-			return nil
+// Less reports whether c sorts before other, ordering ranges by their first
+// index and then by their last, for use with sort.Slice. Ranges which are not
+// fixed sort after all fixed ranges: unbounded ranges first (by first index),
+// followed by suffix ranges (longest first). Since their position within a
+// collection isn't known, ranges should be constrained before being sorted if
+// a meaningful order is required.
+func (c *ContentRange) Less(other *ContentRange) bool {
+	switch {
+	case c.IsFixed() && other.IsFixed():
+		if c.first != other.first {
+			return c.first < other.first
 		}
-		return ErrRangeUnsatisfiableZeroLength
+		return c.last < other.last
+	case c.IsFixed() != other.IsFixed():
+		return c.IsFixed()
+	case c.fBound != other.fBound:
+		return c.fBound
+	case c.fBound:
+		return c.first < other.first
+	}
+	return c.last < other.last
+}
+
+// Constrain resolves the range against a collection of size elements: suffix
+// and unbounded ranges become fixed ranges covering the corresponding elements,
+// and a fixed range extending beyond the end of the collection is clamped to
+// its final element, as RFC 7233 requires.
+// No range -- whatever its form -- can be satisfied by an empty collection, so
+// constraining to a size of 0 returns ErrRangeUnsatisfiable, leaving the range
+// unmodified.
+// Likewise, a suffix of zero elements covers nothing, and returns
+// ErrRangeUnsatisfiableZeroLength. Indices are computed without overflow: a
+// suffix whose length cannot be represented as a positive int64 returns
+// ErrRangeOutsideConstraints, and a negative size ErrRangeInvalid.
+func (c *ContentRange) Constrain(size int64) error {
+	if size < 0 {
+		return ErrRangeInvalid
+	}
+
+	if size == 0 {
+		return ErrRangeUnsatisfiable
 	}
 
 	if !c.fBound {
-		c.first = size + c.last
-		c.fBound = true
-		if c.first < 0 {
+		if c.last == 0 {
+			return ErrRangeUnsatisfiableZeroLength
+		}
+		// a suffix length is stored negated, so a positive last index without
+		// a first is contradictory, and would resolve beyond the collection
+		if c.last > 0 {
+			return ErrRangeInvalid
+		}
+		// the length of the suffix, -c.last, must itself be representable
+		if c.last == math.MinInt64 {
+			return ErrRangeOutsideConstraints
+		}
+		// a suffix longer than the collection covers all of it; comparing
+		// before adding keeps the arithmetic within bounds
+		if c.last < -size {
 			c.first = 0
+		} else {
+			c.first = size + c.last
 		}
+		c.fBound = true
 		c.last = size - 1
 		c.lBound = true
 		return nil
 	}
 
+	if c.first < 0 {
+		return ErrRangeInvalid
+	}
+
 	if c.first > (size - 1) {
 		return ErrRangeOutsideConstraints
 	}
 
+	if c.lBound && c.last > size-1 {
+		c.last = size - 1
+	}
+
 	if !c.lBound {
 		c.last = size - 1
 		c.lBound = true
+		if c.maxWindow > 0 && c.last-c.first >= c.maxWindow {
+			c.last = c.first + c.maxWindow - 1
+			c.clamped = true
+		}
 	}
 
 	return nil
 }
 
-func (c *ContentRange) Offset() int {
+// Overlaps reports whether c and other cover at least one element in common.
+// Ranges with different units, and ranges which aren't fixed, never overlap.
+func (c *ContentRange) Overlaps(other *ContentRange) bool {
+	return c.units == other.units && c.IsFixed() && other.IsFixed() &&
+		c.first <= other.last && other.first <= c.last
+}
+
+// Intersect returns a new fixed range covering the elements which c and other
+// have in common, sharing the units and total of c. It returns
+// ErrRangeUnitsMismatch if the ranges have different units, ErrRangeNotFixed
+// unless both ranges are fixed (constrain suffix and unbounded ranges first),
+// and ErrRangeUnsatisfiableZeroLength if they don't overlap.
+func (c *ContentRange) Intersect(other *ContentRange) (*ContentRange, error) {
+	if c.units != other.units {
+		return nil, ErrRangeUnitsMismatch
+	}
+	if !c.IsFixed() || !other.IsFixed() {
+		return nil, ErrRangeNotFixed
+	}
+	if !c.Overlaps(other) {
+		return nil, ErrRangeUnsatisfiableZeroLength
+	}
+	first, last := c.first, c.last
+	if other.first > first {
+		first = other.first
+	}
+	if other.last < last {
+		last = other.last
+	}
+	return &ContentRange{
+		units:  c.units,
+		first:  first,
+		last:   last,
+		fBound: true,
+		lBound: true,
+		total:  c.total,
+		tBound: c.tBound,
+		form:   RangeFormFixed,
+	}, nil
+}
+
+// ConstrainMax resolves the range against a sequence of values ending at max,
+// inclusive, rather than a collection of elements indexed from 0. It suits
+// ranges over units encoded as integers other than indices, such as epoch
+// seconds or IDs: constrained against a max of 1600003600, the unbounded
+// range "timestamp=1600000000-" covers 1600000000 through 1600003600, and the
+// suffix "timestamp=-3600" covers the last 3600 values, 1600000001 through
+// 1600003600. ConstrainMax returns ErrRangeInvalid if max is negative, or
+// cannot be followed by another value.
+func (c *ContentRange) ConstrainMax(max int64) error {
+	if max < 0 || max == math.MaxInt64 {
+		return ErrRangeInvalid
+	}
+	return c.Constrain(max + 1)
+}
+
+// Normalize validates the range and brings it into a canonical state. When a
+// total has been set, suffix and unbounded ranges are resolved against it and
+// a last index beyond the end of the collection is clamped to the final
+// element. Normalize returns ErrRangeInvalid if the range is contradictory
+// (e.g. its first index follows its last), ErrRangeUnsatisfiableZeroLength if
+// it covers no elements, and ErrRangeOutsideConstraints if it begins beyond
+// the end of the collection.
+func (c *ContentRange) Normalize() error {
+	switch {
+	case !c.fBound && !c.lBound:
+		// an unsatisfiable range is represented by its total alone
+		if !c.tBound {
+			return ErrRangeInvalid
+		}
+	case !c.fBound && c.last == 0:
+		return ErrRangeUnsatisfiableZeroLength
+	case !c.fBound && c.last > 0:
+		return ErrRangeInvalid
+	case c.fBound && c.first < 0:
+		return ErrRangeInvalid
+	case c.fBound && c.lBound && c.last < c.first:
+		return ErrRangeInvalid
+	}
+	if !c.tBound || (!c.fBound && !c.lBound) {
+		return nil
+	}
+	switch {
+	case c.total < 0:
+		return ErrRangeInvalid
+	case c.total == 0:
+		return ErrRangeUnsatisfiable
+	}
+	return c.Constrain(c.total)
+}
+
+// Chunks divides a fixed range into consecutive ranges of at most chunkSize
+// elements each, which together cover the whole range; only the last chunk
+// may be shorter. Chunks share the units and total of the range. Suffix and
+// unbounded ranges must be constrained before being divided.
+func (c *ContentRange) Chunks(chunkSize int64) ([]*ContentRange, error) {
+	if !c.IsFixed() {
+		return nil, ErrRangeNotFixed
+	}
+	if chunkSize <= 0 {
+		return nil, ErrRangeInvalid
+	}
+	var chunks []*ContentRange
+	for first := c.first; first <= c.last; first += chunkSize {
+		last := c.last
+		if c.last-first >= chunkSize {
+			last = first + chunkSize - 1
+		}
+		chunks = append(chunks, &ContentRange{
+			units:  c.units,
+			first:  first,
+			last:   last,
+			fBound: true,
+			lBound: true,
+			total:  c.total,
+			tBound: c.tBound,
+			form:   RangeFormFixed,
+		})
+		if last == c.last {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// SetMaxWindow limits the number of elements an unbounded range (such as
+// "resources=100-") may cover once constrained. Ranges that would otherwise
+// extend beyond the window are clamped to its size, and report WasClamped. A
+// window of 0 or less disables clamping.
+func (c *ContentRange) SetMaxWindow(n int64) {
+	c.maxWindow = n
+}
+
+// WasClamped indicates whether constraining the range clamped it to the
+// window configured with SetMaxWindow.
+func (c *ContentRange) WasClamped() bool {
+	return c.clamped
+}
+
+// Offset returns the index of the first element covered by the range.
+func (c *ContentRange) Offset() int64 {
 	return c.first
 }
 
-func (c *ContentRange) Limit() int {
+// Limit returns the number of elements covered by the range: Last()-First()+1
+// for a fixed range, or the length of a suffix range. Unbounded ranges return
+// RangeUnconstrained. A fixed range of more than math.MaxInt64 elements, such
+// as "bytes=0-9223372036854775807", returns math.MaxInt64, rather than
+// overflowing.
+func (c *ContentRange) Limit() int64 {
 	if c.IsFixed() {
-		return c.last - c.first
+		if c.last-c.first == math.MaxInt64 {
+			return math.MaxInt64
+		}
+		return c.last - c.first + 1
 	}
 	if c.lBound && c.last < 0 {
 		return -c.last
@@ -171,8 +492,20 @@ func (c *ContentRange) Limit() int {
 	return RangeUnconstrained
 }
 
-func (c *ContentRange) SetTotal(total int) error {
+// SetTotal constrains the range to a collection of total elements, as with
+// Constrain, and records the total so that it is included by Format. If the
+// range cannot be satisfied -- because the collection is empty
+// (ErrRangeUnsatisfiable), or the range begins beyond its end
+// (ErrRangeOutsideConstraints) -- the error is returned and the range becomes
+// unsatisfiable, such that Format produces the value of the Content-Range
+// header to send along with a 416 (e.g. "bytes */0").
+func (c *ContentRange) SetTotal(total int64) error {
 	if err := c.Constrain(total); err != nil {
+		if err == ErrRangeUnsatisfiable || err == ErrRangeOutsideConstraints {
+			c.first, c.last = 0, 0
+			c.fBound, c.lBound = false, false
+			c.total, c.tBound = total, true
+		}
 		return err
 	}
 	c.tBound = true
@@ -180,17 +513,73 @@ func (c *ContentRange) SetTotal(total int) error {
 	return nil
 }
 
+// SectionReader constrains the range to a collection of total bytes read from
+// r, such as an *os.File, and returns an io.SectionReader over exactly the
+// bytes it covers.
+func (c *ContentRange) SectionReader(r io.ReaderAt, total int64) (*io.SectionReader, error) {
+	if err := c.SetTotal(total); err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(r, c.first, c.Limit()), nil
+}
+
+// Unsatisfiable indicates whether the range has been found to be unsatisfiable
+// by SetTotal, such that it describes only the total size of the collection.
+func (c *ContentRange) Unsatisfiable() bool {
+	return c.tBound && !c.fBound && !c.lBound
+}
+
+// SatisfiableFor indicates whether the range would cover at least one element
+// of a collection of size elements, as Constrain would find it, without
+// modifying the range: a suffix range is satisfiable by any non-empty
+// collection, and other ranges by any collection extending beyond their first
+// index. This allows a server to choose between 206 and 416 before
+// constraining.
+func (c *ContentRange) SatisfiableFor(size int64) bool {
+	cp := *c
+	return cp.Constrain(size) == nil
+}
+
+// Reader constrains the range to a stream of size bytes read from rs, seeks to
+// the start of the range, and returns a reader over exactly the bytes it
+// covers. Suffix ranges are sought relative to the end of the stream. If the
+// range can't be satisfied, Reader returns the error from SetTotal
+// (ErrRangeUnsatisfiable or ErrRangeOutsideConstraints).
+func (c *ContentRange) Reader(rs io.ReadSeeker, size int64) (io.Reader, error) {
+	if err := c.SetTotal(size); err != nil {
+		return nil, err
+	}
+	n := c.Limit()
+	var err error
+	if c.form == RangeFormSuffix {
+		_, err = rs.Seek(-n, io.SeekEnd)
+	} else {
+		_, err = rs.Seek(c.first, io.SeekStart)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.LimitReader(rs, n), nil
+}
+
+// Reset returns the range to its zero value, clearing its units, bounds,
+// total, and any window set with SetMaxWindow, so that it may be reused.
+func (c *ContentRange) Reset() {
+	*c = ContentRange{}
+}
+
 func (c *ContentRange) Units() string {
 	return c.units
 }
 
 // Format returns a representation of the ContentRange as the body of an HTTP
-// Content-Range header.
+// Content-Range header, in which, like the range itself, both indices are
+// inclusive.
 func (c *ContentRange) Format() (string, error) {
 	// Determine how to render the range.
 	max := "*"
 	if c.tBound {
-		max = strconv.FormatInt(int64(c.total), 10)
+		max = strconv.FormatInt(c.total, 10)
 	}
 
 	// If both upper/lower bounds are missing, render "*/total" pg 12 of RFC 7233.
@@ -205,6 +594,69 @@ func (c *ContentRange) Format() (string, error) {
 	return fmt.Sprintf("%s %d-%d/%s", c.units, c.first, c.last, max), nil
 }
 
+// String returns a human-readable representation of the range for logging and
+// debugging, such as "resources=100-199 (total 200)", "resources=-100
+// (suffix)", or "resources=100- (unbounded)". Unlike Format, it never fails,
+// and its output isn't suitable for use in a header.
+func (c *ContentRange) String() string {
+	var s string
+	var notes []string
+	switch {
+	case c.fBound && c.lBound:
+		s = fmt.Sprintf("%s=%d-%d", c.units, c.first, c.last)
+	case c.fBound:
+		s = fmt.Sprintf("%s=%d-", c.units, c.first)
+		notes = append(notes, "unbounded")
+	case c.lBound:
+		s = fmt.Sprintf("%s=%d", c.units, c.last)
+		notes = append(notes, "suffix")
+	default:
+		s = fmt.Sprintf("%s=*", c.units)
+		notes = append(notes, "unsatisfiable")
+	}
+	if c.tBound {
+		notes = append(notes, fmt.Sprintf("total %d", c.total))
+	}
+	if len(notes) > 0 {
+		s += " (" + strings.Join(notes, ", ") + ")"
+	}
+	return s
+}
+
+// ToResponseForm returns the range as the value of a Content-Range header, such
+// as "items 0-99/500". It is equivalent to Format.
+func (c *ContentRange) ToResponseForm() (string, error) {
+	return c.Format()
+}
+
+// ToRequestForm returns the range as the value of a Range header, such as
+// "items=0-99", "items=100-", or "items=-100", such that ParseRange would
+// produce an equivalent range. Ranges without bounds, which describe only the
+// total size of a collection, have no request form.
+func (c *ContentRange) ToRequestForm() (string, error) {
+	switch {
+	case c.fBound && c.lBound:
+		return fmt.Sprintf("%s=%d-%d", c.units, c.first, c.last), nil
+	case c.fBound:
+		return fmt.Sprintf("%s=%d-", c.units, c.first), nil
+	case c.lBound:
+		return fmt.Sprintf("%s=%d", c.units, c.last), nil
+	}
+	return "", ErrRangeInvalid
+}
+
+// WriteAcceptRanges advertises that ranges of the resource may be requested in
+// units, such as RangeUnitsBytes, by setting the Accept-Ranges header of w.
+func WriteAcceptRanges(w http.ResponseWriter, units string) {
+	w.Header().Set(HeaderNameAcceptRanges, units)
+}
+
+// WriteAcceptRangesNone advertises that ranges of the resource may not be
+// requested, by setting the Accept-Ranges header of w to "none".
+func WriteAcceptRangesNone(w http.ResponseWriter) {
+	WriteAcceptRanges(w, RangeUnitsNone)
+}
+
 // ParseRange parses an HTTP Range header into a *ContentRange. ParseRange only
 // supports single ranges, not multiple. It does not support parameters.
 //
@@ -213,51 +665,259 @@ func (c *ContentRange) Format() (string, error) {
 //   resources=99-   // <- resources from indices [99-n], where n = len(collection)
 //
 func ParseRange(r string) (*ContentRange, error) {
-	var rng = &ContentRange{}
+	rng := &ContentRange{}
+	if err := ParseRangeInto(rng, r); err != nil {
+		return nil, err
+	}
+	return rng, nil
+}
+
+// ParseRangeInto parses an HTTP Range header into dst, as ParseRange does, but
+// without allocating a new ContentRange, so that values may be reused -- from
+// a sync.Pool, for example. dst is Reset before parsing; if an error is
+// returned, its contents are unspecified.
+func ParseRangeInto(dst *ContentRange, r string) error {
+	dst.Reset()
 	var units, s string
-	var first, last int
+	var first, last int64
 	var err error
 	var ok bool
 
 	units, s = expectUnitSpecifier(r)
-	rng.units = units
+	dst.units = units
 
+	suffix := len(s) > 0 && s[0] == '-'
 	first, s, err = expectRangeValue(s)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if suffix && first == 0 {
+		// "-0" asks for none of the final elements, which nothing can satisfy
+		return ErrRangeUnsatisfiableZeroLength
 	}
 	if first < 0 {
-		err = rng.SetLast(int(first))
-		return rng, err
+		// a suffix length must be representable as a positive value
+		if first == math.MinInt64 {
+			return ErrRangeOutsideConstraints
+		}
+		dst.form = RangeFormSuffix
+		return dst.SetLast(first)
 	}
-	err = rng.SetFirst(int(first))
+	dst.form = RangeFormUnbounded
+	err = dst.SetFirst(first)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if len(s) == 0 {
-		return rng, nil
+		return nil
 	}
 
 	s, ok = expectSeparator(s, '-')
 	if ok && len(s) > 0 {
 		last, s, err = expectRangeValue(s)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		err = rng.SetLast(last)
+		err = dst.SetLast(last)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		dst.form = RangeFormFixed
 	}
 
 	if len(s) > 0 {
+		return ErrRangeInvalid
+	}
+
+	return nil
+}
+
+// ParseRanges parses an HTTP Range header which may specify multiple ranges,
+// separated by commas, into a *ContentRange for each, in order. All ranges
+// share the unit specifier at the front of the header, and whitespace around
+// each range is ignored:
+//
+//	bytes=0-99, 200-299, -50  // <- three ranges: [0-99], [200-299], and the last 50 bytes
+//
+// If any range is malformed, ParseRanges fails, returning an error which names
+// the index of the range.
+func ParseRanges(r string) ([]*ContentRange, error) {
+	units, s := expectUnitSpecifier(r)
+	segments := strings.Split(s, ",")
+	ranges := make([]*ContentRange, 0, len(segments))
+	for i, segment := range segments {
+		rng, err := ParseRange(units + "=" + strings.Trim(segment, " \t"))
+		if err != nil {
+			return nil, fmt.Errorf("range %d: %w", i, err)
+		}
+		ranges = append(ranges, rng)
+	}
+	return ranges, nil
+}
+
+// ParseRangeWithUnits parses an HTTP Range header like ParseRange, but returns
+// ErrRangeUnsupportedUnit unless the range is specified in one of the allowed
+// units. Units are compared case-sensitively, and a header without units --
+// one missing its "=" -- is always rejected.
+func ParseRangeWithUnits(r string, allowed ...string) (*ContentRange, error) {
+	units, _ := expectUnitSpecifier(r)
+	if units == "" {
+		return nil, ErrRangeUnsupportedUnit
+	}
+	for _, u := range allowed {
+		if u == units {
+			return ParseRange(r)
+		}
+	}
+	return nil, ErrRangeUnsupportedUnit
+}
+
+// ParseRangeWithMax parses an HTTP Range header like ParseRange, but returns
+// ErrRangeValueTooLarge if the magnitude of either index (including the length
+// of a suffix range) exceeds max. This allows obviously bogus ranges, such as
+// "bytes=0-99999999999999", to be rejected before any work is done. Values too
+// large to be represented at all are also reported as ErrRangeValueTooLarge.
+func ParseRangeWithMax(r string, max int64) (*ContentRange, error) {
+	rng, err := ParseRange(r)
+	if errors.Is(err, strconv.ErrRange) {
+		return nil, ErrRangeValueTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rng.fBound && rng.first > max {
+		return nil, ErrRangeValueTooLarge
+	}
+	if rng.lBound && (rng.last > max || rng.last < -max) {
+		return nil, ErrRangeValueTooLarge
+	}
+	return rng, nil
+}
+
+// ParseAndConstrain parses an HTTP Range header and constrains it to a
+// collection of total elements, returning the resulting range along with the
+// HTTP status code that should be sent in response:
+//
+//   http.StatusOK                           // <- no range, a malformed range, or one covering the entire collection
+//   http.StatusPartialContent               // <- the range covers part of the collection
+//   http.StatusRequestedRangeNotSatisfiable // <- the range cannot be satisfied
+//
+// An empty header yields a nil range. As RFC 7233 requires, a malformed
+// header is ignored: the range returned covers the entire collection (or is
+// nil if the collection is empty), along with the error from parsing it, for
+// logging. When the range cannot be satisfied, the returned range has no
+// bounds, so that its Format method produces the value of the Content-Range
+// header to send along with the 416 (e.g. "bytes */500").
+func ParseAndConstrain(header string, total int64) (*ContentRange, int, error) {
+	if header == "" {
+		return nil, http.StatusOK, nil
+	}
+	rng, err := ParseRange(header)
+	units, _ := expectUnitSpecifier(header)
+	switch {
+	case err == ErrRangeUnsatisfiableZeroLength || err == ErrRangeOutsideConstraints:
+		return unsatisfiableRange(units, total), http.StatusRequestedRangeNotSatisfiable, err
+	case err != nil && total > 0:
+		return &ContentRange{units: units, last: total - 1, total: total,
+			fBound: true, lBound: true, tBound: true, form: RangeFormFixed}, http.StatusOK, err
+	case err != nil:
+		return nil, http.StatusOK, err
+	}
+	if err = rng.SetTotal(total); err != nil {
+		if !rng.Unsatisfiable() {
+			rng = unsatisfiableRange(rng.units, total)
+		}
+		return rng, http.StatusRequestedRangeNotSatisfiable, err
+	}
+	if rng.IsComplete() {
+		return rng, http.StatusOK, nil
+	}
+	return rng, http.StatusPartialContent, nil
+}
+
+// ParseContentRange parses an HTTP Content-Range header, as sent in a response,
+// into a *ContentRange. It accepts each of the forms that Format produces:
+//
+//	bytes 0-99/500  // <- bytes [0-99] of 500
+//	bytes 0-99/*    // <- bytes [0-99] of an unknown number
+//	bytes */500     // <- an unsatisfiable range over 500 bytes
+//
+// ParseContentRange returns ErrRangeInvalid if s is malformed, or if the range
+// it describes extends beyond the total.
+func ParseContentRange(s string) (*ContentRange, error) {
+	sp := strings.IndexByte(s, ' ')
+	if sp <= 0 {
 		return nil, ErrRangeInvalid
 	}
+	units, s := s[:sp], s[sp+1:]
+	slash := strings.IndexByte(s, '/')
+	if slash < 0 {
+		return nil, ErrRangeInvalid
+	}
+	spec, complete := s[:slash], s[slash+1:]
 
+	total := RangeUnconstrained
+	if complete != "*" {
+		var err error
+		if total, err = parseDigits(complete); err != nil {
+			return nil, err
+		}
+	}
+	if spec == "*" {
+		if total == RangeUnconstrained {
+			return nil, ErrRangeInvalid
+		}
+		return unsatisfiableRange(units, total), nil
+	}
+
+	dash := strings.IndexByte(spec, '-')
+	if dash < 0 {
+		return nil, ErrRangeInvalid
+	}
+	first, err := parseDigits(spec[:dash])
+	if err != nil {
+		return nil, err
+	}
+	last, err := parseDigits(spec[dash+1:])
+	if err != nil {
+		return nil, err
+	}
+	rng, err := NewContentRange(units, first, last)
+	if err != nil {
+		return nil, err
+	}
+	if total != RangeUnconstrained {
+		if last >= total {
+			return nil, ErrRangeInvalid
+		}
+		if err := rng.SetTotal(total); err != nil {
+			return nil, err
+		}
+	}
 	return rng, nil
 }
 
+// parseDigits parses s, which must consist solely of decimal digits, as a
+// non-negative integer.
+func parseDigits(s string) (int64, error) {
+	if s == "" {
+		return 0, ErrRangeInvalid
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, ErrRangeInvalid
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// unsatisfiableRange returns an unbound range over a collection of total
+// elements, which formats as "units */total".
+func unsatisfiableRange(units string, total int64) *ContentRange {
+	return &ContentRange{units: units, total: total, tBound: true}
+}
+
 func expectUnitSpecifier(s string) (units, rest string) {
 	for i := 0; i < len(s); i++ {
 		switch s[i] {
@@ -268,7 +928,7 @@ func expectUnitSpecifier(s string) (units, rest string) {
 	return "", ""
 }
 
-func expectRangeValue(s string) (value int, rest string, err error) {
+func expectRangeValue(s string) (value int64, rest string, err error) {
 	// read chars until we encounter a separator or EOL (other than in 1st position)
 	for i := 0; i < len(s); i++ {
 		isPastFirstPos := i > 0
@@ -278,10 +938,10 @@ func expectRangeValue(s string) (value int, rest string, err error) {
 		switch {
 		case isPastFirstPos && !isDigit:
 			v, err := strconv.ParseInt(s[:i], 10, 64)
-			return int(v), s[i:], err
+			return v, s[i:], err
 		case isLastChar:
 			v, err := strconv.ParseInt(s[:i+1], 10, 64)
-			return int(v), s[i+1:], err
+			return v, s[i+1:], err
 		}
 	}
 
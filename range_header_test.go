@@ -1,17 +1,57 @@
 package httpext
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
+var benchmarkRange *ContentRange
+
 func BenchmarkRangeParsing(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkRange, _ = ParseRange("resources=0-99")
+	}
+}
+
+// BenchmarkRangeParsingPooled measures parsing into ranges reused from a
+// sync.Pool, for comparison with BenchmarkRangeParsing.
+func BenchmarkRangeParsingPooled(b *testing.B) {
+	pool := sync.Pool{New: func() interface{} { return &ContentRange{} }}
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		ParseRange("resources=0-99")
+		rng := pool.Get().(*ContentRange)
+		ParseRangeInto(rng, "resources=0-99")
+		benchmarkRange = rng
+		pool.Put(rng)
 	}
 }
 
+func TestParseRangeInto(t *testing.T) {
+	rng := &ContentRange{}
+	assert.NoError(t, ParseRangeInto(rng, "resources=100-199"))
+	rng.SetMaxWindow(10)
+	assert.NoError(t, rng.SetTotal(150))
+
+	assert.NoError(t, ParseRangeInto(rng, "items=-10"), "Ranges should be reusable.")
+	expected, _ := ParseRange("items=-10")
+	assert.Equal(t, *expected, *rng, "Reused ranges should retain nothing from previous parses.")
+
+	assert.Error(t, ParseRangeInto(rng, "items=abc"))
+
+	rng.Reset()
+	assert.Equal(t, ContentRange{}, *rng, "Reset should zero the range.")
+}
+
 func TestRangeSuffix(t *testing.T) {
 	rng, err := ParseRange("resources=-100")
 	if err != nil {
@@ -20,10 +60,10 @@ func TestRangeSuffix(t *testing.T) {
 
 	assert.True(t, rng.IsUnbounded(), "Suffix range should be unbounded.")
 	assert.True(t, rng.IsSuffix(), "Suffix range should be a suffix.")
-	assert.Equal(t, 0, rng.Offset(), "Suffix range cannot have a non-zero offset.")
-	assert.Equal(t, 100, rng.Limit(), "Suffix range should have a positive limit.")
+	assert.Equal(t, int64(0), rng.Offset(), "Suffix range cannot have a non-zero offset.")
+	assert.Equal(t, int64(100), rng.Limit(), "Suffix range should have a positive limit.")
 	assert.Equal(t, RangeUnconstrained, rng.First(), "First index should be 0 for suffix range.")
-	assert.Equal(t, -100, rng.Last(), "Suffix range upper bound should be RangeUnconstrained.")
+	assert.Equal(t, int64(-100), rng.Last(), "Suffix range upper bound should be RangeUnconstrained.")
 
 	_, err = rng.Format()
 	assert.Error(t, err, "Format should fail when no Upper bound has been set for suffix ranges.")
@@ -34,6 +74,15 @@ func TestRangeSuffix(t *testing.T) {
 	assert.Equal(t, "resources 100-199/200", fmt, "")
 }
 
+func TestRangeZeroLengthSuffix(t *testing.T) {
+	_, err := ParseRange("resources=-0")
+	assert.Equal(t, ErrRangeUnsatisfiableZeroLength, err, "A zero-length suffix should be unsatisfiable.")
+
+	rng := &ContentRange{units: "resources", form: RangeFormSuffix}
+	assert.Equal(t, ErrRangeUnsatisfiableZeroLength, rng.Constrain(100),
+		"Constraining a zero-length suffix should fail.")
+}
+
 func TestRangeUnbounded(t *testing.T) {
 	rng, err := ParseRange("resources=100-")
 	if err != nil {
@@ -42,9 +91,9 @@ func TestRangeUnbounded(t *testing.T) {
 
 	assert.True(t, rng.IsUnbounded(), "Unbounded range should be unbounded.")
 	assert.False(t, rng.IsSuffix(), "Range '100-' is not a suffix.")
-	assert.Equal(t, 100, rng.Offset(), "Range '100-' should have an Offset of 100.")
+	assert.Equal(t, int64(100), rng.Offset(), "Range '100-' should have an Offset of 100.")
 	assert.Equal(t, RangeUnconstrained, rng.Limit(), "When unbounded in length, range should have a -1 limit.")
-	assert.Equal(t, 100, rng.First(), "Range lower bound should be 100.")
+	assert.Equal(t, int64(100), rng.First(), "Range lower bound should be 100.")
 	assert.Equal(t, RangeUnconstrained, rng.Last(), "Range upper bound should be unconstrained.")
 
 	fmt, err := rng.Format()
@@ -64,10 +113,10 @@ func TestRangeBounded(t *testing.T) {
 
 	assert.False(t, rng.IsUnbounded(), "Bounded range should not be unbounded.")
 	assert.False(t, rng.IsSuffix(), "Bounded range is not a suffix.")
-	assert.Equal(t, 100, rng.Offset(), "Bounded range's Offset should be correct.")
-	assert.Equal(t, 100, rng.Limit(), "Bounded range's Limit should be correct.")
-	assert.Equal(t, 100, rng.First(), "Bounded range's lower bound should be 100.")
-	assert.Equal(t, 200, rng.Last(), "Bounded range's upper bound should be 200.")
+	assert.Equal(t, int64(100), rng.Offset(), "Bounded range's Offset should be correct.")
+	assert.Equal(t, int64(100), rng.Limit(), "Bounded range's Limit should be correct.")
+	assert.Equal(t, int64(100), rng.First(), "Bounded range's lower bound should be 100.")
+	assert.Equal(t, int64(199), rng.Last(), "Bounded range's upper bound should be 199 (inclusive).")
 
 	fmt, err := rng.Format()
 	assert.NoError(t, err, "Range formatting should not fail when range is bounded.")
@@ -79,3 +128,757 @@ func TestRangeBounded(t *testing.T) {
 	assert.NoError(t, err, "Range should be formattable with total.")
 	assert.Equal(t, "resources 100-199/200", fmt, "Range should be formattable without total.")
 }
+
+var parseAndConstrainTests = []struct {
+	header  string
+	total   int64
+	status  int
+	content string
+}{
+	{"", 100, http.StatusOK, ""},
+	{"resources=0-", 100, http.StatusOK, "resources 0-99/100"},
+	{"resources=0-99", 100, http.StatusOK, "resources 0-99/100"},
+	{"resources=-200", 100, http.StatusOK, "resources 0-99/100"},
+	{"resources=10-19", 100, http.StatusPartialContent, "resources 10-19/100"},
+	{"resources=90-", 100, http.StatusPartialContent, "resources 90-99/100"},
+	{"resources=-10", 100, http.StatusPartialContent, "resources 90-99/100"},
+	{"resources=100-199", 100, http.StatusRequestedRangeNotSatisfiable, "resources */100"},
+	{"resources=0-9", 0, http.StatusRequestedRangeNotSatisfiable, "resources */0"},
+	{"resources=-10", 0, http.StatusRequestedRangeNotSatisfiable, "resources */0"},
+	{"resources=-0", 100, http.StatusRequestedRangeNotSatisfiable, "resources */100"},
+}
+
+func TestRangeInclusiveBounds(t *testing.T) {
+	for _, s := range []string{"resources=0-0", "resources=0-99", "resources=100-199", "resources=5-", "resources=-10"} {
+		rng, err := ParseRange(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(t, rng.SetTotal(200))
+
+		assert.Equal(t, rng.Limit(), rng.Last()-rng.First()+1, "%q should cover Last()-First()+1 elements.", s)
+		assert.True(t, rng.Contains(rng.First()), "%q should contain its first index.", s)
+		assert.True(t, rng.Contains(rng.Last()), "%q should contain its last index.", s)
+		assert.False(t, rng.Contains(rng.Last()+1), "%q should not contain the index following its last.", s)
+
+		formatted, err := rng.Format()
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("resources %d-%d/200", rng.First(), rng.Last()), formatted,
+			"%q should format its bounds as they are reported.", s)
+	}
+
+	rng, err := NewContentRange("resources", 10, 10)
+	assert.NoError(t, err, "A range may cover a single element.")
+	assert.Equal(t, int64(1), rng.Limit())
+	assert.Equal(t, ErrRangeInvalid, rng.SetFirst(11), "First may not follow Last.")
+	assert.NoError(t, rng.SetFirst(5))
+	assert.Equal(t, ErrRangeInvalid, rng.SetLast(4), "Last may not precede First.")
+	assert.Equal(t, int64(6), rng.Limit())
+
+	rng, err = NewContentRange("bytes", 0, math.MaxInt64)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), rng.Limit(), "Limit should saturate rather than overflow.")
+	rng, err = ParseRange("bytes=0-9223372036854775807")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), rng.Limit(), "Limit should saturate rather than overflow.")
+	rng, err = ParseRange("bytes=1-9223372036854775807")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), rng.Limit())
+}
+
+func TestParseAndConstrain(t *testing.T) {
+	for _, tt := range parseAndConstrainTests {
+		rng, status, err := ParseAndConstrain(tt.header, tt.total)
+		assert.Equal(t, tt.status, status, "ParseAndConstrain(%q, %d) status", tt.header, tt.total)
+		if tt.status == http.StatusRequestedRangeNotSatisfiable {
+			assert.Error(t, err, "ParseAndConstrain(%q, %d) should fail", tt.header, tt.total)
+		} else {
+			assert.NoError(t, err, "ParseAndConstrain(%q, %d) should not fail", tt.header, tt.total)
+		}
+		if tt.content == "" {
+			assert.Nil(t, rng, "ParseAndConstrain(%q, %d) should not return a range", tt.header, tt.total)
+			continue
+		}
+		content, err := rng.Format()
+		assert.NoError(t, err, "ParseAndConstrain(%q, %d) range should be formattable", tt.header, tt.total)
+		assert.Equal(t, tt.content, content, "ParseAndConstrain(%q, %d) Content-Range", tt.header, tt.total)
+	}
+}
+
+func TestParseAndConstrainMalformed(t *testing.T) {
+	for _, header := range []string{"resources=10-5", "resources=abc", "resources=0-9x", "resources"} {
+		rng, status, err := ParseAndConstrain(header, 100)
+		assert.Equal(t, http.StatusOK, status, "Malformed header %q should be ignored.", header)
+		assert.Error(t, err, "The error parsing %q should be returned.", header)
+		assert.True(t, rng.IsComplete(), "Malformed header %q should yield the entire collection.", header)
+		assert.Equal(t, int64(100), rng.Limit())
+
+		rng, status, err = ParseAndConstrain(header, 0)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Error(t, err)
+		assert.Nil(t, rng, "Malformed header %q should yield no range for an empty collection.", header)
+	}
+}
+
+var parseRangeWithMaxTests = []struct {
+	s   string
+	err error
+}{
+	{"bytes=0-1000", nil},
+	{"bytes=1000-", nil},
+	{"bytes=-1000", nil},
+	{"bytes=0-1001", ErrRangeValueTooLarge},
+	{"bytes=1001-", ErrRangeValueTooLarge},
+	{"bytes=-1001", ErrRangeValueTooLarge},
+	{"bytes=0-99999999999999999999", ErrRangeValueTooLarge},
+}
+
+func TestParseRangeWithMax(t *testing.T) {
+	for _, tt := range parseRangeWithMaxTests {
+		rng, err := ParseRangeWithMax(tt.s, 1000)
+		if tt.err != nil {
+			assert.ErrorIs(t, err, tt.err, "ParseRangeWithMax(%q) should fail", tt.s)
+			assert.Nil(t, rng)
+			continue
+		}
+		assert.NoError(t, err, "ParseRangeWithMax(%q) should not fail", tt.s)
+		assert.NotNil(t, rng)
+	}
+}
+
+var parseRangeWithUnitsTests = []struct {
+	s   string
+	err error
+}{
+	{"items=0-99", nil},
+	{"bytes=0-99", nil},
+	{"gibberish=0-10", ErrRangeUnsupportedUnit},
+	{"Bytes=0-99", ErrRangeUnsupportedUnit},
+	{"0-99", ErrRangeUnsupportedUnit},
+	{"=0-99", ErrRangeUnsupportedUnit},
+	{"bytes=abc", ErrRangeInvalid},
+}
+
+func TestParseRangeWithUnits(t *testing.T) {
+	for _, tt := range parseRangeWithUnitsTests {
+		rng, err := ParseRangeWithUnits(tt.s, "items", "bytes")
+		switch tt.err {
+		case nil:
+			assert.NoError(t, err, "ParseRangeWithUnits(%q) should not fail", tt.s)
+			assert.NotNil(t, rng)
+		case ErrRangeUnsupportedUnit:
+			assert.ErrorIs(t, err, tt.err, "ParseRangeWithUnits(%q)", tt.s)
+		default:
+			assert.Error(t, err, "ParseRangeWithUnits(%q) should fail", tt.s)
+		}
+	}
+}
+
+var originalFormTests = []struct {
+	s    string
+	form RangeForm
+}{
+	{"resources=-100", RangeFormSuffix},
+	{"resources=100-", RangeFormUnbounded},
+	{"resources=100-199", RangeFormFixed},
+}
+
+func TestRangeOriginalForm(t *testing.T) {
+	for _, tt := range originalFormTests {
+		rng, err := ParseRange(tt.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tt.form, rng.OriginalForm(), "OriginalForm of %q", tt.s)
+		assert.NoError(t, rng.SetTotal(500), "Constraining %q should not fail.", tt.s)
+		assert.Equal(t, tt.form, rng.OriginalForm(), "OriginalForm of %q after constraining", tt.s)
+	}
+
+	rng, _ := ParseRange("resources=-100")
+	rng.SetTotal(200)
+	assert.False(t, rng.IsSuffix(), "Constrained suffix range should no longer be a suffix.")
+	assert.Equal(t, RangeFormSuffix, rng.OriginalForm(), "Constrained suffix range should originate as a suffix.")
+	assert.Equal(t, "suffix", rng.OriginalForm().String(), "RangeForm should be printable.")
+
+	rng, _ = NewContentRange("resources", 0, 9)
+	assert.Equal(t, RangeFormFixed, rng.OriginalForm(), "NewContentRange should create a fixed range.")
+	assert.Equal(t, RangeFormUnknown, (&ContentRange{}).OriginalForm(), "Zero value should have an unknown form.")
+}
+
+func TestRangeMaxWindow(t *testing.T) {
+	rng, err := ParseRange("resources=100-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng.SetMaxWindow(50)
+	assert.NoError(t, rng.SetTotal(1000), "Constraining should not fail.")
+	assert.True(t, rng.WasClamped(), "Range exceeding the window should be clamped.")
+	fmt, err := rng.Format()
+	assert.NoError(t, err, "Clamped range should be formattable.")
+	assert.Equal(t, "resources 100-149/1000", fmt, "Range should be clamped to the window.")
+
+	rng, _ = ParseRange("resources=100-")
+	rng.SetMaxWindow(50)
+	rng.SetTotal(120)
+	assert.False(t, rng.WasClamped(), "Range within the window should not be clamped.")
+	assert.Equal(t, int64(119), rng.Last(), "Range within the window should cover the remainder.")
+
+	rng, _ = ParseRange("resources=100-")
+	rng.SetMaxWindow(50)
+	rng.SetTotal(150)
+	assert.False(t, rng.WasClamped(), "Range exactly filling the window should not be clamped.")
+	assert.Equal(t, int64(149), rng.Last(), "Range exactly filling the window should cover the remainder.")
+
+	rng, _ = ParseRange("resources=100-999")
+	rng.SetMaxWindow(50)
+	rng.SetTotal(1000)
+	assert.False(t, rng.WasClamped(), "Fixed ranges should not be clamped.")
+	assert.Equal(t, int64(999), rng.Last(), "Fixed ranges should not be clamped.")
+}
+
+var normalizeTests = []struct {
+	name   string
+	rng    ContentRange
+	err    error
+	expect string
+}{
+	{"fixed", ContentRange{units: "r", first: 0, last: 9, fBound: true, lBound: true},
+		nil, "r 0-9/*"},
+	{"fixed with total", ContentRange{units: "r", first: 0, last: 9, fBound: true, lBound: true, total: 20, tBound: true},
+		nil, "r 0-9/20"},
+	{"fixed past total", ContentRange{units: "r", first: 5, last: 99, fBound: true, lBound: true, total: 20, tBound: true},
+		nil, "r 5-19/20"},
+	{"unbounded with total", ContentRange{units: "r", first: 5, fBound: true, total: 20, tBound: true},
+		nil, "r 5-19/20"},
+	{"suffix with total", ContentRange{units: "r", last: -5, lBound: true, total: 20, tBound: true},
+		nil, "r 15-19/20"},
+	{"unsatisfiable", ContentRange{units: "r", total: 20, tBound: true},
+		nil, "r */20"},
+	{"no bounds", ContentRange{units: "r"}, ErrRangeInvalid, ""},
+	{"inverted", ContentRange{units: "r", first: 10, last: 5, fBound: true, lBound: true},
+		ErrRangeInvalid, ""},
+	{"negative first", ContentRange{units: "r", first: -10, last: 5, fBound: true, lBound: true},
+		ErrRangeInvalid, ""},
+	{"positive last only", ContentRange{units: "r", last: 5, lBound: true}, ErrRangeInvalid, ""},
+	{"zero-length suffix", ContentRange{units: "r", last: 0, lBound: true},
+		ErrRangeUnsatisfiableZeroLength, ""},
+	{"empty collection", ContentRange{units: "r", first: 0, last: 9, fBound: true, lBound: true, tBound: true},
+		ErrRangeUnsatisfiable, ""},
+	{"outside total", ContentRange{units: "r", first: 30, last: 39, fBound: true, lBound: true, total: 20, tBound: true},
+		ErrRangeOutsideConstraints, ""},
+}
+
+func TestRangeNormalize(t *testing.T) {
+	for _, tt := range normalizeTests {
+		rng := tt.rng
+		err := rng.Normalize()
+		assert.Equal(t, tt.err, err, "Normalize of %s range", tt.name)
+		if err != nil {
+			continue
+		}
+		fmt, err := rng.Format()
+		assert.NoError(t, err, "Normalized %s range should be formattable", tt.name)
+		assert.Equal(t, tt.expect, fmt, "Normalized %s range", tt.name)
+	}
+
+	// SetLast followed by a contradictory SetFirst is caught by Normalize.
+	rng := &ContentRange{units: "r"}
+	rng.SetLast(10)
+	rng.SetFirst(20)
+	assert.Equal(t, ErrRangeInvalid, rng.Normalize(), "Contradictory setters should be caught.")
+}
+
+func TestRangeLess(t *testing.T) {
+	specs := []string{
+		"r=-10", "r=200-", "r=50-99", "r=-100", "r=0-9", "r=100-", "r=50-59", "r=0-99",
+	}
+	var ranges []*ContentRange
+	for _, s := range specs {
+		rng, err := ParseRange(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ranges = append(ranges, rng)
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Less(ranges[j]) })
+
+	var sorted []string
+	for _, rng := range ranges {
+		switch rng.OriginalForm() {
+		case RangeFormSuffix:
+			sorted = append(sorted, fmt.Sprintf("r=%d", rng.Last()))
+		case RangeFormUnbounded:
+			sorted = append(sorted, fmt.Sprintf("r=%d-", rng.First()))
+		default:
+			sorted = append(sorted, fmt.Sprintf("r=%d-%d", rng.First(), rng.Last()))
+		}
+	}
+	assert.Equal(t, []string{
+		"r=0-9", "r=0-99", "r=50-59", "r=50-99", "r=100-", "r=200-", "r=-100", "r=-10",
+	}, sorted, "Ranges should sort by first then last, with fixed ranges first.")
+}
+
+func TestRangeConstrainExtremes(t *testing.T) {
+	rng := &ContentRange{units: "r"}
+	rng.SetLast(-1)
+	assert.NoError(t, rng.Constrain(math.MaxInt64), "Constraining to the largest size should not fail.")
+	assert.Equal(t, int64(math.MaxInt64-1), rng.First(), "Suffix should resolve to the final element.")
+	assert.Equal(t, int64(math.MaxInt64-1), rng.Last(), "Suffix should resolve to the final element.")
+
+	rng = &ContentRange{units: "r"}
+	rng.SetLast(math.MinInt64 + 1)
+	assert.NoError(t, rng.Constrain(math.MaxInt64), "Constraining the longest suffix should not fail.")
+	assert.Equal(t, int64(0), rng.First(), "Longest suffix should cover the whole collection.")
+	assert.Equal(t, int64(math.MaxInt64-1), rng.Last(), "Longest suffix should cover the whole collection.")
+
+	rng = &ContentRange{units: "r"}
+	rng.SetLast(math.MinInt64 + 1)
+	assert.NoError(t, rng.Constrain(10), "Constraining a suffix longer than the collection should not fail.")
+	assert.Equal(t, int64(0), rng.First(), "Long suffix should cover the whole collection.")
+	assert.Equal(t, int64(9), rng.Last(), "Long suffix should cover the whole collection.")
+
+	rng = &ContentRange{units: "r"}
+	rng.SetLast(math.MinInt64)
+	assert.Equal(t, ErrRangeOutsideConstraints, rng.Constrain(10),
+		"A suffix whose length cannot be represented should be rejected.")
+	assert.False(t, rng.Contains(math.MinInt64), "Contains should not overflow.")
+
+	rng = &ContentRange{units: "r"}
+	rng.SetFirst(0)
+	assert.NoError(t, rng.Constrain(math.MaxInt64), "Constraining to the largest size should not fail.")
+	assert.Equal(t, int64(math.MaxInt64-1), rng.Last(), "Unbounded range should resolve to the final element.")
+
+	rng = &ContentRange{units: "r"}
+	rng.SetLast(-10)
+	assert.Equal(t, ErrRangeInvalid, rng.Constrain(-5), "Negative sizes should be rejected.")
+
+	rng, _ = NewContentRange("r", math.MinInt64, 10)
+	assert.Equal(t, ErrRangeInvalid, rng.Constrain(100), "Negative first indices should be rejected.")
+
+	_, err := ParseRange("r=-9223372036854775808")
+	assert.Equal(t, ErrRangeOutsideConstraints, err,
+		"A suffix whose length cannot be represented should not parse.")
+	_, err = ParseRange("r=0-99999999999999999999")
+	assert.Error(t, err, "Values too large to represent should not parse.")
+}
+
+// formatAll formats each of a set of ranges.
+func formatAll(t *testing.T, ranges []*ContentRange) []string {
+	var s []string
+	for _, rng := range ranges {
+		f, err := rng.Format()
+		assert.NoError(t, err, "Range should be formattable.")
+		s = append(s, f)
+	}
+	return s
+}
+
+func FuzzRangeConstrain(f *testing.F) {
+	f.Add(int64(0), int64(99), true, true, int64(100), int64(0))
+	f.Add(int64(100), int64(0), true, false, int64(1000), int64(50))
+	f.Add(int64(0), int64(-100), false, true, int64(10), int64(0))
+	f.Add(int64(0), int64(math.MinInt64), false, true, int64(math.MaxInt64), int64(0))
+	f.Add(int64(0), int64(math.MinInt64+1), false, true, int64(math.MaxInt64), int64(0))
+	f.Add(int64(math.MaxInt64), int64(math.MaxInt64), true, true, int64(math.MaxInt64), int64(math.MaxInt64))
+	f.Add(int64(math.MinInt64), int64(0), true, false, int64(-1), int64(-1))
+	f.Fuzz(func(t *testing.T, first, last int64, fBound, lBound bool, size, maxWindow int64) {
+		if !fBound && !lBound {
+			return
+		}
+		rng := &ContentRange{units: "r", maxWindow: maxWindow}
+		if fBound {
+			rng.SetFirst(first)
+		}
+		if lBound && rng.SetLast(last) != nil {
+			return
+		}
+		if err := rng.Constrain(size); err != nil {
+			return
+		}
+		if !rng.IsFixed() {
+			t.Fatalf("constrained range %v is not fixed", rng)
+		}
+		if rng.First() < 0 || rng.First() > rng.Last() || rng.Last() >= size {
+			t.Fatalf("constrained range %v does not lie within [0, %d)", rng, size)
+		}
+		if rng.Limit() < 1 || rng.Limit() > size {
+			t.Fatalf("constrained range %v covers %d of %d elements", rng, rng.Limit(), size)
+		}
+	})
+}
+
+func TestRangeChunks(t *testing.T) {
+	rng, _ := ParseRange("bytes=0-")
+	rng.SetTotal(300)
+	chunks, err := rng.Chunks(100)
+	assert.NoError(t, err, "Dividing a constrained range should not fail.")
+	assert.Equal(t, []string{"bytes 0-99/300", "bytes 100-199/300", "bytes 200-299/300"},
+		formatAll(t, chunks), "Range should divide exactly into chunks.")
+
+	rng, _ = ParseRange("bytes=10-259")
+	chunks, err = rng.Chunks(100)
+	assert.NoError(t, err, "Dividing a fixed range should not fail.")
+	assert.Equal(t, []string{"bytes 10-109/*", "bytes 110-209/*", "bytes 210-259/*"},
+		formatAll(t, chunks), "The last chunk should hold the remainder.")
+
+	chunks, err = rng.Chunks(1000)
+	assert.NoError(t, err, "Dividing into a single chunk should not fail.")
+	assert.Equal(t, []string{"bytes 10-259/*"}, formatAll(t, chunks),
+		"A chunk larger than the range should cover the whole range.")
+
+	rng, _ = ParseRange("bytes=-100")
+	_, err = rng.Chunks(10)
+	assert.Equal(t, ErrRangeNotFixed, err, "Unconstrained ranges should not be divided.")
+
+	rng, _ = ParseRange("bytes=0-99")
+	_, err = rng.Chunks(0)
+	assert.Equal(t, ErrRangeInvalid, err, "Chunks must have a positive size.")
+}
+
+func TestRangeSectionReader(t *testing.T) {
+	data := bytes.NewReader([]byte("0123456789abcdefghij"))
+	for _, tt := range []struct {
+		s    string
+		want string
+	}{
+		{"bytes=5-9", "56789"},
+		{"bytes=-4", "ghij"},
+		{"bytes=15-", "fghij"},
+		{"bytes=18-99", "ij"},
+	} {
+		rng, err := ParseRange(tt.s)
+		assert.NoError(t, err)
+		sr, err := rng.SectionReader(data, data.Size())
+		assert.NoError(t, err, "SectionReader for %q should not fail", tt.s)
+		b, err := io.ReadAll(sr)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, string(b), "SectionReader for %q", tt.s)
+	}
+
+	rng, _ := ParseRange("bytes=20-29")
+	_, err := rng.SectionReader(data, data.Size())
+	assert.ErrorIs(t, err, ErrRangeOutsideConstraints)
+}
+
+func TestRangeRequestResponseForm(t *testing.T) {
+	rng, err := ParseRange("items=0-99")
+	assert.NoError(t, err)
+	assert.NoError(t, rng.SetTotal(500))
+	resp, err := rng.ToResponseForm()
+	assert.NoError(t, err)
+	assert.Equal(t, "items 0-99/500", resp)
+	req, err := rng.ToRequestForm()
+	assert.NoError(t, err)
+	assert.Equal(t, "items=0-99", req)
+
+	for _, s := range []string{"items=0-99", "items=100-", "items=-100"} {
+		rng, err := ParseRange(s)
+		assert.NoError(t, err)
+		req, err := rng.ToRequestForm()
+		assert.NoError(t, err, "ToRequestForm for %q should not fail", s)
+		assert.Equal(t, s, req, "Request form should round-trip.")
+	}
+
+	_, err = unsatisfiableRange("items", 500).ToRequestForm()
+	assert.ErrorIs(t, err, ErrRangeInvalid, "Ranges without bounds have no request form.")
+}
+
+var isCompleteTests = []struct {
+	s        string
+	total    int64
+	complete bool
+}{
+	{"resources=0-99", 100, true},
+	{"resources=0-50", 100, false},
+	{"resources=1-99", 100, false},
+	{"resources=0-", 100, true},
+	{"resources=-100", 100, true},
+	{"resources=-99", 100, false},
+}
+
+func TestRangeIsComplete(t *testing.T) {
+	for _, tt := range isCompleteTests {
+		rng, err := ParseRange(tt.s)
+		assert.NoError(t, err)
+		assert.False(t, rng.IsComplete(), "%q should not be complete before SetTotal", tt.s)
+		assert.NoError(t, rng.SetTotal(tt.total))
+		assert.Equal(t, tt.complete, rng.IsComplete(), "%q/%d IsComplete", tt.s, tt.total)
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	ranges, err := ParseRanges("bytes=0-99, 200-299,\t-50 ,900-")
+	assert.NoError(t, err)
+	var forms []string
+	for _, r := range ranges {
+		assert.Equal(t, "bytes", r.Units(), "Ranges should share units.")
+		f, err := r.ToRequestForm()
+		assert.NoError(t, err)
+		forms = append(forms, f)
+	}
+	assert.Equal(t, []string{"bytes=0-99", "bytes=200-299", "bytes=-50", "bytes=900-"}, forms,
+		"Ranges should be parsed in order.")
+
+	ranges, err = ParseRanges("bytes=0-99")
+	assert.NoError(t, err)
+	assert.Len(t, ranges, 1, "A single range should be parsed.")
+
+	_, err = ParseRanges("bytes=0-99,abc,200-299")
+	assert.Error(t, err, "Malformed ranges should be rejected.")
+	assert.Contains(t, err.Error(), "range 1", "The error should name the malformed range.")
+
+	_, err = ParseRanges("bytes=0-99,")
+	assert.Error(t, err, "Empty ranges should be rejected.")
+}
+
+func TestRangeUnsatisfiable(t *testing.T) {
+	for _, s := range []string{"resources=0-9", "resources=10-", "resources=-10"} {
+		rng, err := ParseRange(s)
+		assert.NoError(t, err)
+		assert.False(t, rng.Unsatisfiable())
+		assert.ErrorIs(t, rng.Constrain(0), ErrRangeUnsatisfiable,
+			"Constraining %q to an empty collection should fail", s)
+		assert.False(t, rng.Unsatisfiable(), "Constrain should not modify %q", s)
+
+		assert.ErrorIs(t, rng.SetTotal(0), ErrRangeUnsatisfiable,
+			"SetTotal(0) for %q should fail", s)
+		assert.True(t, rng.Unsatisfiable(), "%q should be unsatisfiable", s)
+		f, err := rng.Format()
+		assert.NoError(t, err)
+		assert.Equal(t, "resources */0", f, "Unsatisfiable %q should format as */0", s)
+	}
+
+	rng, _ := ParseRange("resources=100-199")
+	assert.ErrorIs(t, rng.SetTotal(50), ErrRangeOutsideConstraints)
+	assert.True(t, rng.Unsatisfiable(), "Ranges beyond the collection should be unsatisfiable.")
+	f, _ := rng.Format()
+	assert.Equal(t, "resources */50", f)
+
+	rng, _ = ParseRange("resources=0-9")
+	assert.NoError(t, rng.SetTotal(50))
+	assert.False(t, rng.Unsatisfiable())
+}
+
+var satisfiableForTests = []struct {
+	s           string
+	size        int64
+	satisfiable bool
+}{
+	{"resources=-10", 1, true},
+	{"resources=-10", 100, true},
+	{"resources=-10", 0, false},
+	{"resources=10-", 11, true},
+	{"resources=10-", 10, false},
+	{"resources=10-19", 11, true},
+	{"resources=10-19", 10, false},
+	{"resources=0-0", 1, true},
+	{"resources=0-9", 0, false},
+}
+
+func TestRangeSatisfiableFor(t *testing.T) {
+	for _, tt := range satisfiableForTests {
+		rng, err := ParseRange(tt.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := *rng
+		assert.Equal(t, tt.satisfiable, rng.SatisfiableFor(tt.size), "%q satisfiable for %d", tt.s, tt.size)
+		assert.Equal(t, before, *rng, "SatisfiableFor should not modify %q", tt.s)
+	}
+}
+
+func TestRangeLargeOffsets(t *testing.T) {
+	rng, err := ParseRange("bytes=5000000000-6000000000")
+	assert.NoError(t, err, "Offsets beyond 32 bits should be parsed.")
+	assert.Equal(t, int64(5000000000), rng.First())
+	assert.Equal(t, int64(6000000000), rng.Last())
+
+	assert.NoError(t, rng.SetTotal(8000000000))
+	f, err := rng.Format()
+	assert.NoError(t, err)
+	assert.Equal(t, "bytes 5000000000-6000000000/8000000000", f)
+}
+
+func TestRangeString(t *testing.T) {
+	for _, tt := range []struct {
+		s, want string
+	}{
+		{"resources=100-199", "resources=100-199"},
+		{"resources=-100", "resources=-100 (suffix)"},
+		{"resources=100-", "resources=100- (unbounded)"},
+	} {
+		rng, err := ParseRange(tt.s)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, rng.String(), "String of %q", tt.s)
+	}
+
+	rng, _ := ParseRange("resources=100-199")
+	rng.SetTotal(200)
+	assert.Equal(t, "resources=100-199 (total 200)", rng.String())
+	assert.Equal(t, "resources=100-199 (total 200)", fmt.Sprint(rng), "ContentRange should be a Stringer.")
+	rng.SetTotal(0)
+	assert.Equal(t, "resources=* (unsatisfiable, total 0)", rng.String())
+	assert.Equal(t, "=* (unsatisfiable)", (&ContentRange{}).String(), "String should not fail for empty ranges.")
+}
+
+func TestRangeTimestamps(t *testing.T) {
+	const max = 1600003600
+	rng, err := ParseRange("timestamp=1600000000-1600001800")
+	assert.NoError(t, err, "Ranges over timestamps should be parsed.")
+	assert.Equal(t, "timestamp", rng.Units())
+	assert.Equal(t, int64(1600000000), rng.Offset())
+	assert.NoError(t, rng.ConstrainMax(max))
+	assert.Equal(t, int64(1600001800), rng.Last(), "Fixed ranges within the max should be unchanged.")
+
+	rng, _ = ParseRange("timestamp=1600000000-")
+	assert.NoError(t, rng.ConstrainMax(max))
+	assert.Equal(t, int64(1600000000), rng.First())
+	assert.Equal(t, int64(max), rng.Last(), "Unbounded ranges should extend to the max.")
+
+	rng, _ = ParseRange("timestamp=-3600")
+	assert.NoError(t, rng.ConstrainMax(max))
+	assert.Equal(t, int64(max-3599), rng.First(), "Suffix ranges should cover the final values.")
+	assert.Equal(t, int64(max), rng.Last())
+
+	rng, _ = ParseRange("timestamp=1600003601-")
+	assert.ErrorIs(t, rng.ConstrainMax(max), ErrRangeOutsideConstraints,
+		"Ranges beginning after the max should not be satisfiable.")
+	assert.ErrorIs(t, rng.ConstrainMax(math.MaxInt64), ErrRangeInvalid)
+}
+
+var parseContentRangeTests = []struct {
+	s     string
+	ok    bool
+	first int64
+	last  int64
+}{
+	{"bytes 0-99/500", true, 0, 99},
+	{"bytes 400-499/500", true, 400, 499},
+	{"items 0-99/*", true, 0, 99},
+	{"bytes */500", true, RangeUnconstrained, RangeUnconstrained},
+	{"bytes 0-500/500", false, 0, 0},
+	{"bytes 99-0/500", false, 0, 0},
+	{"bytes */*", false, 0, 0},
+	{"bytes 0-99", false, 0, 0},
+	{"bytes=0-99/500", false, 0, 0},
+	{"bytes -5-99/500", false, 0, 0},
+	{"bytes 0-+99/500", false, 0, 0},
+	{"bytes 0-99/50a", false, 0, 0},
+	{"", false, 0, 0},
+}
+
+func TestParseContentRange(t *testing.T) {
+	for _, tt := range parseContentRangeTests {
+		rng, err := ParseContentRange(tt.s)
+		if !tt.ok {
+			assert.Error(t, err, "ParseContentRange(%q) should fail", tt.s)
+			continue
+		}
+		assert.NoError(t, err, "ParseContentRange(%q) should not fail", tt.s)
+		assert.Equal(t, tt.first, rng.First(), "ParseContentRange(%q) first", tt.s)
+		assert.Equal(t, tt.last, rng.Last(), "ParseContentRange(%q) last", tt.s)
+
+		// round trip
+		f, err := rng.Format()
+		assert.NoError(t, err)
+		assert.Equal(t, tt.s, f, "ParseContentRange(%q) should round-trip through Format", tt.s)
+	}
+
+	rng, _ := ParseRange("bytes=-100")
+	rng.SetTotal(1000)
+	f, _ := rng.Format()
+	parsed, err := ParseContentRange(f)
+	assert.NoError(t, err)
+	assert.Equal(t, rng.First(), parsed.First())
+	assert.Equal(t, rng.Last(), parsed.Last())
+	assert.True(t, parsed.IsComplete() == rng.IsComplete())
+	assert.True(t, parsed.Unsatisfiable() == rng.Unsatisfiable())
+}
+
+func TestParseContentRangeUnboundedRoundTrip(t *testing.T) {
+	rng, err := ParseRange("bytes=500-")
+	assert.NoError(t, err)
+	assert.NoError(t, rng.SetTotal(1000))
+	f, err := rng.Format()
+	assert.NoError(t, err)
+	assert.Equal(t, "bytes 500-999/1000", f, "Unbounded ranges should be resolved by their total.")
+
+	parsed, err := ParseContentRange(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "bytes=500-999 (total 1000)", parsed.String())
+	assert.Equal(t, rng.String(), parsed.String(),
+		"Unbounded ranges with a total should round-trip through ParseContentRange.")
+	reformatted, err := parsed.Format()
+	assert.NoError(t, err)
+	assert.Equal(t, f, reformatted)
+}
+
+var intersectTests = []struct {
+	a, b   string
+	err    error
+	expect string
+}{
+	{"bytes=0-99", "bytes=50-149", nil, "bytes=50-99"},
+	{"bytes=50-149", "bytes=0-99", nil, "bytes=50-99"},
+	{"bytes=0-99", "bytes=10-19", nil, "bytes=10-19"},
+	{"bytes=0-99", "bytes=99-199", nil, "bytes=99-99"},
+	{"bytes=0-99", "bytes=100-199", ErrRangeUnsatisfiableZeroLength, ""},
+	{"bytes=0-99", "items=0-99", ErrRangeUnitsMismatch, ""},
+	{"bytes=0-99", "bytes=50-", ErrRangeNotFixed, ""},
+	{"bytes=-50", "bytes=0-99", ErrRangeNotFixed, ""},
+}
+
+func TestRangeIntersect(t *testing.T) {
+	for _, tt := range intersectTests {
+		a, _ := ParseRange(tt.a)
+		b, _ := ParseRange(tt.b)
+		assert.Equal(t, tt.err == nil, a.Overlaps(b), "%q overlaps %q", tt.a, tt.b)
+		rng, err := a.Intersect(b)
+		if tt.err != nil {
+			assert.ErrorIs(t, err, tt.err, "Intersection of %q and %q", tt.a, tt.b)
+			continue
+		}
+		assert.NoError(t, err, "Intersection of %q and %q", tt.a, tt.b)
+		f, _ := rng.ToRequestForm()
+		assert.Equal(t, tt.expect, f, "Intersection of %q and %q", tt.a, tt.b)
+	}
+}
+
+func TestRangeReader(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	for _, tt := range []struct {
+		s    string
+		want string
+	}{
+		{"bytes=5-9", "56789"},
+		{"bytes=-4", "ghij"},
+		{"bytes=15-", "fghij"},
+		{"bytes=18-99", "ij"},
+	} {
+		rng, err := ParseRange(tt.s)
+		assert.NoError(t, err)
+		r, err := rng.Reader(bytes.NewReader(data), int64(len(data)))
+		assert.NoError(t, err, "Reader for %q should not fail", tt.s)
+		b, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, string(b), "Reader for %q", tt.s)
+	}
+
+	rng, _ := ParseRange("bytes=20-29")
+	_, err := rng.Reader(bytes.NewReader(data), int64(len(data)))
+	assert.ErrorIs(t, err, ErrRangeOutsideConstraints)
+	rng, _ = ParseRange("bytes=-10")
+	_, err = rng.Reader(bytes.NewReader(nil), 0)
+	assert.ErrorIs(t, err, ErrRangeUnsatisfiable)
+}
+
+func TestWriteAcceptRanges(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteAcceptRanges(w, RangeUnitsBytes)
+	WriteAcceptRanges(w, RangeUnitsBytes)
+	assert.Equal(t, []string{"bytes"}, w.Header().Values(HeaderNameAcceptRanges),
+		"Accept-Ranges should be written once.")
+
+	WriteAcceptRangesNone(w)
+	assert.Equal(t, []string{"none"}, w.Header().Values(HeaderNameAcceptRanges))
+}
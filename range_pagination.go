@@ -0,0 +1,108 @@
+package httpext
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// PaginationHeaders names the headers written alongside Content-Range to
+// describe a page of a collection. Headers with empty names are not written.
+type PaginationHeaders struct {
+	// TotalCount names the header carrying the total size of the collection.
+	TotalCount string
+
+	// Offset names the header carrying the index of the first element of the
+	// page.
+	Offset string
+
+	// Limit names the header carrying the number of elements in the page.
+	Limit string
+}
+
+// DefaultPaginationHeaders are the headers written by WritePaginationHeaders.
+var DefaultPaginationHeaders = PaginationHeaders{
+	TotalCount: "X-Total-Count",
+	Offset:     "X-Offset",
+	Limit:      "X-Limit",
+}
+
+// Write writes the Content-Range header for c to w, along with the pagination
+// headers named by p. The range must have been constrained with SetTotal;
+// Write returns ErrRangeNotFixed otherwise.
+func (p PaginationHeaders) Write(w http.ResponseWriter, c *ContentRange) error {
+	if !c.IsFixed() || !c.tBound {
+		return ErrRangeNotFixed
+	}
+	contentRange, err := c.Format()
+	if err != nil {
+		return err
+	}
+	h := w.Header()
+	h.Set(HeaderNameContentRange, contentRange)
+	if p.TotalCount != "" {
+		h.Set(p.TotalCount, strconv.FormatInt(c.total, 10))
+	}
+	if p.Offset != "" {
+		h.Set(p.Offset, strconv.FormatInt(c.first, 10))
+	}
+	if p.Limit != "" {
+		h.Set(p.Limit, strconv.FormatInt(c.Limit(), 10))
+	}
+	return nil
+}
+
+// WritePaginationHeaders writes the Content-Range header for the range to w,
+// along with the headers named by DefaultPaginationHeaders. The range must
+// have been constrained with SetTotal.
+func (c *ContentRange) WritePaginationHeaders(w http.ResponseWriter) error {
+	return DefaultPaginationHeaders.Write(w, c)
+}
+
+// Next returns the range for the page following c, of the same size, and
+// whether there is such a page. The range must be fixed and constrained with
+// SetTotal; the last index of the following page is clamped to the end of the
+// collection.
+func (c *ContentRange) Next() (*ContentRange, bool) {
+	if !c.IsFixed() || !c.tBound || c.last >= c.total-1 {
+		return nil, false
+	}
+	size := c.Limit()
+	first := c.last + 1
+	last := c.total - 1
+	if size <= last-first {
+		last = first + size - 1
+	}
+	return c.page(first, last), true
+}
+
+// Prev returns the range for the page preceding c, of the same size, and
+// whether there is such a page. The range must be fixed and constrained with
+// SetTotal; the first index of the preceding page is clamped to the start of
+// the collection.
+func (c *ContentRange) Prev() (*ContentRange, bool) {
+	if !c.IsFixed() || !c.tBound || c.first <= 0 {
+		return nil, false
+	}
+	size := c.Limit()
+	last := c.first - 1
+	first := int64(0)
+	if size <= last {
+		first = last - size + 1
+	}
+	return c.page(first, last), true
+}
+
+// page returns a fixed range from first to last, sharing the units and total
+// of c.
+func (c *ContentRange) page(first, last int64) *ContentRange {
+	return &ContentRange{
+		units:  c.units,
+		first:  first,
+		last:   last,
+		fBound: true,
+		lBound: true,
+		total:  c.total,
+		tBound: true,
+		form:   RangeFormFixed,
+	}
+}
@@ -0,0 +1,63 @@
+package httpext
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePaginationHeaders(t *testing.T) {
+	rng, _ := ParseRange("resources=100-149")
+	w := httptest.NewRecorder()
+	assert.ErrorIs(t, rng.WritePaginationHeaders(w), ErrRangeNotFixed,
+		"Ranges without a total should not be written.")
+
+	assert.NoError(t, rng.SetTotal(1000))
+	assert.NoError(t, rng.WritePaginationHeaders(w))
+	assert.Equal(t, "resources 100-149/1000", w.Header().Get("Content-Range"))
+	assert.Equal(t, "1000", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, "100", w.Header().Get("X-Offset"))
+	assert.Equal(t, "50", w.Header().Get("X-Limit"))
+
+	w = httptest.NewRecorder()
+	p := PaginationHeaders{TotalCount: "Total-Records"}
+	assert.NoError(t, p.Write(w, rng))
+	assert.Equal(t, "resources 100-149/1000", w.Header().Get("Content-Range"))
+	assert.Equal(t, "1000", w.Header().Get("Total-Records"))
+	assert.Equal(t, "", w.Header().Get("X-Offset"), "Unnamed headers should not be written.")
+}
+
+// pages follows step from the range s over total elements until it reports no
+// more pages, returning the request form of each page.
+func pages(t *testing.T, s string, total int64, step func(*ContentRange) (*ContentRange, bool)) []string {
+	rng, err := ParseRange(s)
+	assert.NoError(t, err)
+	assert.NoError(t, rng.SetTotal(total))
+	var forms []string
+	for {
+		var ok bool
+		if rng, ok = step(rng); !ok {
+			return forms
+		}
+		f, _ := rng.ToRequestForm()
+		forms = append(forms, f)
+	}
+}
+
+func TestRangeNextPrev(t *testing.T) {
+	next := (*ContentRange).Next
+	prev := (*ContentRange).Prev
+	assert.Equal(t, []string{"resources=100-199", "resources=200-249"},
+		pages(t, "resources=0-99", 250, next), "The last page should be clamped to the total.")
+	assert.Equal(t, []string{"resources=50-99", "resources=0-49"},
+		pages(t, "resources=100-149", 250, prev))
+	assert.Equal(t, []string{"resources=0-29"},
+		pages(t, "resources=30-79", 250, prev), "The first page should be clamped to the start.")
+	assert.Nil(t, pages(t, "resources=0-", 250, next), "The complete range has no next page.")
+	assert.Nil(t, pages(t, "resources=0-", 250, prev), "The complete range has no previous page.")
+
+	rng, _ := ParseRange("resources=0-99")
+	_, ok := rng.Next()
+	assert.False(t, ok, "Ranges without a total have no next page.")
+}
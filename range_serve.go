@@ -0,0 +1,138 @@
+package httpext
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServePartial replies to req with the contents of rs, a collection of size
+// elements in the given units, honoring the request's Range header much like
+// http.ServeContent does for bytes:
+//
+//	http.StatusOK                           // <- no range, a malformed one, or one covering the whole collection
+//	http.StatusPartialContent               // <- the requested range, with Content-Range
+//	http.StatusRequestedRangeNotSatisfiable // <- an unsatisfiable range, with "units */size"
+//
+// Unlike http.ServeContent, the units are arbitrary, so that any collection
+// which can be read as a stream of elements may be served; for units other
+// than bytes, rs must address elements rather than bytes. Ranges in other
+// units, and requests for multiple ranges, are ignored, and the whole
+// collection is served. As with http.ServeContent, an If-Range precondition
+// is evaluated against any ETag or Last-Modified header already set on w; if
+// it fails, the whole collection is served. Accept-Ranges is always set to
+// advertise units, and no body is written in response to HEAD requests.
+func ServePartial(w http.ResponseWriter, req *http.Request, units string, size int64, rs io.ReadSeeker) {
+	WriteAcceptRanges(w, units)
+	header := req.Header.Get("Range")
+	if u, spec := expectUnitSpecifier(header); u != units || strings.Contains(spec, ",") {
+		header = ""
+	}
+	lastModified, _ := http.ParseTime(w.Header().Get("Last-Modified"))
+	if !EvaluateIfRange(req, w.Header().Get("ETag"), lastModified) {
+		header = ""
+	}
+
+	rng, status, _ := ParseAndConstrain(header, size)
+	switch status {
+	case http.StatusRequestedRangeNotSatisfiable:
+		contentRange, _ := rng.Format()
+		w.Header().Set(HeaderNameContentRange, contentRange)
+		w.WriteHeader(status)
+		return
+	case http.StatusPartialContent:
+		contentRange, _ := rng.Format()
+		w.Header().Set(HeaderNameContentRange, contentRange)
+	default:
+		rng = &ContentRange{units: units, last: size - 1, fBound: true, lBound: true}
+	}
+
+	n := rng.Limit()
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	if _, err := rs.Seek(rng.first, io.SeekStart); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	if req.Method != "HEAD" {
+		io.CopyN(w, rs, n)
+	}
+}
+
+// EvaluateIfRange indicates whether the Range header of req should be honored,
+// given the current ETag and modification time of the representation (either
+// of which may be empty or zero if unknown). It reports true unless req
+// carries an If-Range precondition which fails, as RFC 7233 specifies:
+//
+//	If-Range: "abc"                          // <- honored if etag is the strong validator "abc"
+//	If-Range: W/"abc"                        // <- never honored; weak validators can't be used
+//	If-Range: Tue, 15 Nov 1994 08:12:31 GMT  // <- honored if lastModified is exactly that time
+//
+// When EvaluateIfRange reports false, the whole representation should be
+// served with http.StatusOK, rather than the requested range.
+func EvaluateIfRange(req *http.Request, etag string, lastModified time.Time) bool {
+	ifRange := req.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, "W/") || strings.HasPrefix(ifRange, `"`) {
+		// only a strong comparison can validate a range
+		return isStrongETag(ifRange) && ifRange == etag
+	}
+	t, err := http.ParseTime(ifRange)
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	return lastModified.Truncate(time.Second).Equal(t)
+}
+
+// isStrongETag indicates whether etag is a well-formed strong entity tag, such
+// as "abc" (quotes included).
+func isStrongETag(etag string) bool {
+	return len(etag) >= 2 && etag[0] == '"' && etag[len(etag)-1] == '"' &&
+		!strings.Contains(etag[1:len(etag)-1], `"`)
+}
+
+// DeclareContentRangeTrailer announces, by way of the Trailer header of w, that
+// the Content-Range of the response will follow its body as a trailer, for
+// streaming a range of a collection whose total size isn't known until the
+// stream ends. It must be called before the response header is written, and
+// the response must be sent without a Content-Length, such that it's chunked.
+// Once the body has been written, call WriteContentRangeTrailer with the
+// total.
+//
+// Since RFC 7230 prohibits recipients from processing Content-Range in
+// trailers unless they know to expect it, this is only suitable for clients
+// which read it from the response's trailers explicitly.
+func DeclareContentRangeTrailer(w http.ResponseWriter) {
+	w.Header().Add("Trailer", HeaderNameContentRange)
+}
+
+// WriteContentRangeTrailer sets the Content-Range trailer declared with
+// DeclareContentRangeTrailer to rng, once the collection has been found to
+// hold total elements, constraining rng with SetTotal:
+//
+//	items 0-99/500  // <- a range 0-99 of 500 items
+//	items 0-49/50   // <- a range 0-99, of which only 50 items were streamed
+//	items */0       // <- a range beyond the end of the collection (returning the error)
+//
+// If rng cannot be satisfied, the trailer reports only the total, and the
+// error from SetTotal is returned; should SetTotal fail otherwise, no trailer
+// is set. It must be called after the body has been written, but before the
+// handler returns.
+func WriteContentRangeTrailer(w http.ResponseWriter, rng *ContentRange, total int64) error {
+	err := rng.SetTotal(total)
+	if err != nil && !rng.Unsatisfiable() {
+		return err
+	}
+	contentRange, ferr := rng.Format()
+	if ferr != nil {
+		return ferr
+	}
+	// net/http doesn't send Content-Range trailers which have merely been
+	// declared, so it's set using the prefix for undeclared trailers
+	w.Header().Set(http.TrailerPrefix+HeaderNameContentRange, contentRange)
+	return err
+}
@@ -0,0 +1,162 @@
+package httpext
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var servePartialTests = []struct {
+	method       string
+	rangeHeader  string
+	status       int
+	contentRange string
+	body         string
+}{
+	{"GET", "", http.StatusOK, "", "0123456789abcdefghij"},
+	{"GET", "bytes=5-9", http.StatusPartialContent, "bytes 5-9/20", "56789"},
+	{"GET", "bytes=-4", http.StatusPartialContent, "bytes 16-19/20", "ghij"},
+	{"GET", "bytes=15-", http.StatusPartialContent, "bytes 15-19/20", "fghij"},
+	{"GET", "bytes=18-99", http.StatusPartialContent, "bytes 18-19/20", "ij"},
+	{"GET", "bytes=0-", http.StatusOK, "", "0123456789abcdefghij"},
+	{"GET", "bytes=20-29", http.StatusRequestedRangeNotSatisfiable, "bytes */20", ""},
+	{"GET", "bytes=abc", http.StatusOK, "", "0123456789abcdefghij"},
+	{"GET", "items=0-4", http.StatusOK, "", "0123456789abcdefghij"},
+	{"GET", "bytes=0-1,5-6", http.StatusOK, "", "0123456789abcdefghij"},
+	{"HEAD", "bytes=5-9", http.StatusPartialContent, "bytes 5-9/20", ""},
+}
+
+func TestServePartial(t *testing.T) {
+	const data = "0123456789abcdefghij"
+	for _, tt := range servePartialTests {
+		req := httptest.NewRequest(tt.method, "/", nil)
+		if tt.rangeHeader != "" {
+			req.Header.Set("Range", tt.rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		ServePartial(w, req, "bytes", int64(len(data)), strings.NewReader(data))
+
+		assert.Equal(t, tt.status, w.Code, "%s with Range %q status", tt.method, tt.rangeHeader)
+		assert.Equal(t, tt.contentRange, w.Header().Get("Content-Range"),
+			"%s with Range %q Content-Range", tt.method, tt.rangeHeader)
+		assert.Equal(t, tt.body, w.Body.String(), "%s with Range %q body", tt.method, tt.rangeHeader)
+		assert.Equal(t, "bytes", w.Header().Get(HeaderNameAcceptRanges))
+		if tt.status != http.StatusRequestedRangeNotSatisfiable && tt.method == "GET" {
+			assert.Equal(t, strconv.Itoa(len(tt.body)), w.Header().Get("Content-Length"),
+				"%s with Range %q Content-Length", tt.method, tt.rangeHeader)
+		}
+	}
+}
+
+var evaluateIfRangeTests = []struct {
+	ifRange string
+	honored bool
+}{
+	{"", true},
+	{`"v1"`, true},
+	{`"v2"`, false},
+	{`W/"v1"`, false},
+	{`"v1`, false},
+	{"Tue, 15 Nov 1994 08:12:31 GMT", true},
+	{"Tue, 15 Nov 1994 08:12:30 GMT", false},
+	{"yesterday", false},
+}
+
+func TestEvaluateIfRange(t *testing.T) {
+	lastModified := time.Date(1994, time.November, 15, 8, 12, 31, 500, time.UTC)
+	for _, tt := range evaluateIfRangeTests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.ifRange != "" {
+			req.Header.Set("If-Range", tt.ifRange)
+		}
+		assert.Equal(t, tt.honored, EvaluateIfRange(req, `"v1"`, lastModified), "If-Range %q", tt.ifRange)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-Range", `W/"v1"`)
+	assert.False(t, EvaluateIfRange(req, `W/"v1"`, time.Time{}), "Weak ETags should never match.")
+	req.Header.Set("If-Range", "Tue, 15 Nov 1994 08:12:31 GMT")
+	assert.False(t, EvaluateIfRange(req, "", time.Time{}), "Dates should not match an unknown modification time.")
+}
+
+func TestServePartialIfRange(t *testing.T) {
+	const data = "0123456789abcdefghij"
+	for _, tt := range []struct {
+		ifRange string
+		status  int
+		body    string
+	}{
+		{`"v1"`, http.StatusPartialContent, "56789"},
+		{`W/"v1"`, http.StatusOK, data},
+		{"Tue, 15 Nov 1994 08:12:31 GMT", http.StatusPartialContent, "56789"},
+		{"Wed, 16 Nov 1994 08:12:31 GMT", http.StatusOK, data},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Range", "bytes=5-9")
+		req.Header.Set("If-Range", tt.ifRange)
+		w := httptest.NewRecorder()
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Tue, 15 Nov 1994 08:12:31 GMT")
+		ServePartial(w, req, "bytes", int64(len(data)), strings.NewReader(data))
+		assert.Equal(t, tt.status, w.Code, "If-Range %q status", tt.ifRange)
+		assert.Equal(t, tt.body, w.Body.String(), "If-Range %q body", tt.ifRange)
+	}
+}
+
+func TestContentRangeTrailer(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rng, err := ParseRange(req.Header.Get("Range"))
+		assert.NoError(t, err)
+		DeclareContentRangeTrailer(w)
+		w.WriteHeader(http.StatusPartialContent)
+		// the number of items is only known once they've all been streamed
+		var total int64
+		for ; total < 50; total++ {
+			if rng.Contains(total) {
+				w.Write([]byte("item\n"))
+			}
+		}
+		assert.NoError(t, WriteContentRangeTrailer(w, rng, total))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Range", "items=40-99")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := w.Result()
+	assert.Equal(t, "Content-Range", resp.Header.Get("Trailer"))
+	assert.Equal(t, "", resp.Header.Get(HeaderNameContentRange))
+	assert.Equal(t, "items 40-49/50", resp.Trailer.Get(HeaderNameContentRange))
+	assert.Equal(t, strings.Repeat("item\n", 10), w.Body.String())
+
+	// net/http must actually send the trailer
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	req, _ = http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Range", "items=0-9")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, strings.Repeat("item\n", 10), string(body))
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Equal(t, "items 0-9/50", resp.Trailer.Get(HeaderNameContentRange),
+		"The Content-Range trailer should be sent once the body has been streamed.")
+}
+
+func TestWriteContentRangeTrailerUnsatisfiable(t *testing.T) {
+	rng, err := ParseRange("items=60-99")
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	DeclareContentRangeTrailer(w)
+	w.WriteHeader(http.StatusPartialContent)
+	assert.ErrorIs(t, WriteContentRangeTrailer(w, rng, 50), ErrRangeOutsideConstraints)
+	assert.Equal(t, "items */50", w.Result().Trailer.Get(HeaderNameContentRange),
+		"A range beyond the end of the stream should report only the total.")
+}
@@ -0,0 +1,181 @@
+package httpext
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+)
+
+// RangeSet holds the ranges requested by a single Range header, such as
+// "bytes=0-99,200-299,-50", for serving multipart range responses.
+type RangeSet struct {
+	ranges []*ContentRange
+}
+
+// Add appends one or more ranges to the set.
+func (s *RangeSet) Add(r ...*ContentRange) {
+	s.ranges = append(s.ranges, r...)
+}
+
+// Ranges returns the ranges in the set, in order.
+func (s *RangeSet) Ranges() []*ContentRange {
+	return s.ranges
+}
+
+// Validate checks that each range in the set is well-formed and that all
+// ranges share the same units, returning an error identifying the first range
+// which isn't, wrapping ErrRangeUnitsMismatch should its units differ.
+func (s *RangeSet) Validate() error {
+	for i, r := range s.ranges {
+		switch {
+		case r.units != s.ranges[0].units:
+			return fmt.Errorf("range %d: units %q differ from %q: %w", i, r.units,
+				s.ranges[0].units, ErrRangeUnitsMismatch)
+		case r.fBound && r.first < 0,
+			r.fBound && r.lBound && r.last < r.first,
+			!r.fBound && r.lBound && r.last > 0:
+			return fmt.Errorf("range %d: %w", i, ErrRangeInvalid)
+		case !r.fBound && !r.lBound:
+			return fmt.Errorf("range %d: %w", i, ErrRangeNotFixed)
+		}
+	}
+	return nil
+}
+
+// ConstrainAll constrains each range in the set to a collection of total
+// elements, as Satisfiable does, replacing the ranges in the set with the
+// satisfiable ones. Ranges which cannot be satisfied, because they begin
+// beyond the end of the collection, are removed from the set; if none remain,
+// ConstrainAll returns ErrRangeUnsatisfiable for an empty collection, and
+// ErrRangeOutsideConstraints otherwise. Should any range be malformed, the set
+// is left unmodified, and its error is returned identifying its index.
+func (s *RangeSet) ConstrainAll(total int64) error {
+	satisfiable, err := s.Satisfiable(total)
+	switch {
+	case err == ErrRangeSetUnsatisfiable && total == 0:
+		err = ErrRangeUnsatisfiable
+	case err == ErrRangeSetUnsatisfiable:
+		err = ErrRangeOutsideConstraints
+	case err != nil:
+		return err
+	}
+	s.ranges = satisfiable.ranges
+	return err
+}
+
+// ErrRangeSetUnsatisfiable is returned by Satisfiable if none of the ranges in
+// a set can be satisfied; the request should be answered with
+// http.StatusRequestedRangeNotSatisfiable.
+var ErrRangeSetUnsatisfiable = errors.New("no range in the set can be satisfied")
+
+// Satisfiable returns a new set holding only those ranges in s which can be
+// satisfied by a collection of total elements, in order, each constrained
+// against total as by SetTotal. As RFC 7233 prescribes, a server should serve
+// these and ignore the rest. If none remain, Satisfiable returns an empty set
+// along with ErrRangeSetUnsatisfiable. Should any range be malformed, or cover
+// no elements, its error is returned, identifying its index. Unlike
+// ConstrainAll, s and its ranges are left unmodified.
+func (s *RangeSet) Satisfiable(total int64) (RangeSet, error) {
+	var satisfiable RangeSet
+	for i, r := range s.ranges {
+		c := *r
+		switch err := c.SetTotal(total); err {
+		case nil:
+			satisfiable.ranges = append(satisfiable.ranges, &c)
+		case ErrRangeUnsatisfiable, ErrRangeOutsideConstraints:
+			// ignored, as RFC 7233 prescribes
+		default:
+			return RangeSet{}, fmt.Errorf("range %d: %w", i, err)
+		}
+	}
+	if len(satisfiable.ranges) == 0 {
+		return satisfiable, ErrRangeSetUnsatisfiable
+	}
+	return satisfiable, nil
+}
+
+// Coalesce sorts the ranges in the set, and merges those which overlap or are
+// adjacent, such that "0-99,50-149,150-199" becomes "0-199". Ranges which are
+// not fixed are left at the end of the set, unmerged; constrain the set first
+// to coalesce them as well. Ranges with different units are never merged.
+func (s *RangeSet) Coalesce() {
+	sort.SliceStable(s.ranges, func(i, j int) bool {
+		return s.ranges[i].Less(s.ranges[j])
+	})
+	s.ranges = coalesceSorted(s.ranges)
+}
+
+// CoalesceRanges merges overlapping and adjacent ranges into the minimal set of
+// ranges covering the same elements, sorted by first index, such that
+// "0-99,100-199,50-120" becomes "0-199". Collapsing many small ranges in this
+// way defends against requests for thousands of tiny, overlapping ranges. All
+// ranges must be fixed and share the same units; CoalesceRanges returns
+// ErrRangeNotFixed or ErrRangeUnitsMismatch otherwise. The ranges given are
+// not modified.
+func CoalesceRanges(ranges []*ContentRange) ([]*ContentRange, error) {
+	for _, r := range ranges {
+		if !r.IsFixed() {
+			return nil, ErrRangeNotFixed
+		}
+		if r.units != ranges[0].units {
+			return nil, ErrRangeUnitsMismatch
+		}
+	}
+	sorted := append([]*ContentRange(nil), ranges...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Less(sorted[j])
+	})
+	return coalesceSorted(sorted), nil
+}
+
+// coalesceSorted merges overlapping and adjacent fixed ranges sharing the same
+// units in a single pass over ranges, which must be sorted. Merged ranges are
+// copies; the ranges given are not modified.
+func coalesceSorted(ranges []*ContentRange) []*ContentRange {
+	var merged []*ContentRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.IsFixed() && merged[n-1].IsFixed() &&
+			r.units == merged[n-1].units && r.first <= merged[n-1].last+1 {
+			if r.last > merged[n-1].last {
+				prev := *merged[n-1]
+				prev.last = r.last
+				merged[n-1] = &prev
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// TotalLength returns the number of elements covered by the ranges in the set,
+// counting any overlap between ranges more than once, or RangeUnconstrained if
+// any range is not fixed. Should the total exceed math.MaxInt64, it returns
+// math.MaxInt64.
+func (s *RangeSet) TotalLength() int64 {
+	var n int64
+	for _, r := range s.ranges {
+		if !r.IsFixed() {
+			return RangeUnconstrained
+		}
+		l := r.Limit()
+		if l > math.MaxInt64-n {
+			return math.MaxInt64
+		}
+		n += l
+	}
+	return n
+}
+
+// StatusCode returns the HTTP status code with which to respond to a request
+// for the ranges in the set, once constrained: http.StatusPartialContent if
+// any range can be satisfied, and http.StatusRequestedRangeNotSatisfiable
+// otherwise.
+func (s *RangeSet) StatusCode() int {
+	if len(s.ranges) == 0 {
+		return http.StatusRequestedRangeNotSatisfiable
+	}
+	return http.StatusPartialContent
+}
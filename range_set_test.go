@@ -0,0 +1,141 @@
+package httpext
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rangeSet returns a set of the ranges parsed from each of s.
+func rangeSet(t *testing.T, s ...string) *RangeSet {
+	set := &RangeSet{}
+	for _, r := range s {
+		rng, err := ParseRange(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set.Add(rng)
+	}
+	return set
+}
+
+// formatSet returns the formatted ranges of set.
+func formatSet(set *RangeSet) []string {
+	var s []string
+	for _, r := range set.Ranges() {
+		f, _ := r.Format()
+		s = append(s, f)
+	}
+	return s
+}
+
+func TestRangeSetConstrainAll(t *testing.T) {
+	set := rangeSet(t, "bytes=0-99", "bytes=-50", "bytes=900-", "bytes=950-1999", "bytes=1000-")
+	assert.NoError(t, set.Validate())
+	assert.NoError(t, set.ConstrainAll(1000))
+	assert.Equal(t, []string{
+		"bytes 0-99/1000",
+		"bytes 950-999/1000",
+		"bytes 900-999/1000",
+		"bytes 950-999/1000",
+	}, formatSet(set), "Unsatisfiable ranges should be removed.")
+	assert.Equal(t, int64(100+50+100+50), set.TotalLength())
+	assert.Equal(t, http.StatusPartialContent, set.StatusCode())
+
+	set.Coalesce()
+	assert.Equal(t, []string{"bytes 0-99/1000", "bytes 900-999/1000"}, formatSet(set))
+	assert.Equal(t, int64(200), set.TotalLength())
+}
+
+func TestRangeSetUnsatisfiable(t *testing.T) {
+	set := rangeSet(t, "bytes=1000-", "bytes=2000-2999")
+	assert.ErrorIs(t, set.ConstrainAll(1000), ErrRangeOutsideConstraints)
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, set.StatusCode())
+}
+
+func TestRangeSetConstrainAllEmpty(t *testing.T) {
+	set := rangeSet(t, "bytes=0-99", "bytes=-50")
+	assert.ErrorIs(t, set.ConstrainAll(0), ErrRangeUnsatisfiable,
+		"No range can be satisfied by an empty collection.")
+	assert.Empty(t, set.Ranges())
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, set.StatusCode())
+}
+
+func TestRangeSetConstrainAllMalformed(t *testing.T) {
+	set := rangeSet(t, "bytes=0-99", "bytes=-50")
+	set.Add(&ContentRange{units: "bytes", lBound: true})
+	err := set.ConstrainAll(1000)
+	assert.ErrorIs(t, err, ErrRangeUnsatisfiableZeroLength, "Malformed ranges should be reported.")
+	assert.Contains(t, err.Error(), "range 2", "The malformed range should be identified.")
+	assert.Len(t, set.Ranges(), 3, "The set should be unmodified.")
+	assert.True(t, set.Ranges()[1].IsSuffix(), "The set should be unmodified.")
+}
+
+func TestRangeSetSatisfiable(t *testing.T) {
+	set := rangeSet(t, "bytes=0-99", "bytes=1000-1099", "bytes=-50", "bytes=950-1999", "bytes=2000-")
+	satisfiable, err := set.Satisfiable(1000)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"bytes 0-99/1000",
+		"bytes 950-999/1000",
+		"bytes 950-999/1000",
+	}, formatSet(&satisfiable), "Only satisfiable ranges should be returned, constrained.")
+	assert.Equal(t, http.StatusPartialContent, satisfiable.StatusCode())
+	assert.Equal(t, 5, len(set.Ranges()), "The original set should be unmodified.")
+	assert.True(t, set.Ranges()[2].IsSuffix(), "The original ranges should be unmodified.")
+
+	satisfiable, err = rangeSet(t, "bytes=1000-", "bytes=2000-2999").Satisfiable(1000)
+	assert.ErrorIs(t, err, ErrRangeSetUnsatisfiable)
+	assert.Empty(t, satisfiable.Ranges())
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, satisfiable.StatusCode())
+}
+
+func TestRangeSetCoalesce(t *testing.T) {
+	set := rangeSet(t, "bytes=150-199", "bytes=-10", "bytes=50-149", "bytes=0-99", "bytes=300-399")
+	set.Coalesce()
+	assert.Equal(t, 3, len(set.Ranges()))
+	assert.Equal(t, []int64{0, 300}, []int64{set.Ranges()[0].First(), set.Ranges()[1].First()})
+	assert.Equal(t, []int64{199, 399}, []int64{set.Ranges()[0].Last(), set.Ranges()[1].Last()})
+	assert.True(t, set.Ranges()[2].IsSuffix(), "Suffix ranges should be left at the end.")
+	assert.Equal(t, RangeUnconstrained, set.TotalLength())
+}
+
+func TestRangeSetTotalLengthOverflow(t *testing.T) {
+	set := rangeSet(t, "bytes=0-9223372036854775807", "bytes=0-9")
+	assert.Equal(t, int64(math.MaxInt64), set.TotalLength(), "TotalLength should saturate rather than overflow.")
+}
+
+func TestRangeSetValidate(t *testing.T) {
+	set := rangeSet(t, "bytes=0-99", "items=0-99")
+	err := set.Validate()
+	assert.ErrorIs(t, err, ErrRangeUnitsMismatch, "Mixed units should be flagged.")
+	assert.False(t, errors.Is(err, ErrRangeInvalid), "Mixed units should be distinguishable from invalid ranges.")
+}
+
+func TestCoalesceRanges(t *testing.T) {
+	ranges, err := ParseRanges("bytes=500-599,0-99,100-199,50-120,300-399,350-360,400-449")
+	assert.NoError(t, err)
+	coalesced, err := CoalesceRanges(ranges)
+	assert.NoError(t, err)
+	var forms []string
+	for _, r := range coalesced {
+		f, _ := r.ToRequestForm()
+		forms = append(forms, f)
+	}
+	assert.Equal(t, []string{"bytes=0-199", "bytes=300-449", "bytes=500-599"}, forms,
+		"Overlapping and adjacent ranges should be merged.")
+	f, _ := ranges[1].ToRequestForm()
+	assert.Equal(t, "bytes=0-99", f, "The ranges given should not be modified.")
+
+	ranges, _ = ParseRanges("bytes=0-99,-50")
+	_, err = CoalesceRanges(ranges)
+	assert.ErrorIs(t, err, ErrRangeNotFixed)
+
+	a, _ := ParseRange("bytes=0-99")
+	b, _ := ParseRange("items=0-99")
+	_, err = CoalesceRanges([]*ContentRange{a, b})
+	assert.ErrorIs(t, err, ErrRangeUnitsMismatch)
+}